@@ -0,0 +1,97 @@
+package pgxgcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+
+	"cloud.google.com/go/alloydbconn"
+	"github.com/jackc/pgx/v5"
+)
+
+// alloyDBInstancePattern matches an AlloyDB instance URI.
+var alloyDBInstancePattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/clusters/[^/]+/instances/[^/]+$`)
+
+// AlloyDBDialer dials AlloyDB instances by their instance URI. It is
+// implemented by *alloydbconn.Dialer.
+type AlloyDBDialer interface {
+	// Dial returns a connection to the given instance.
+	Dial(ctx context.Context, instance string, options ...alloydbconn.DialOption) (net.Conn, error)
+	// Close releases the resources held by the dialer.
+	Close() error
+}
+
+var _ AlloyDBDialer = &alloydbconn.Dialer{}
+
+// AlloyDBConnector connects to an AlloyDB instance using the AlloyDB Go
+// connector. It mirrors Connector, so switching between Cloud SQL and AlloyDB
+// only requires a different constructor.
+type AlloyDBConnector struct {
+	// Dialer is the underlying dialer used to connect to the AlloyDB instance.
+	Dialer AlloyDBDialer
+	// IAMAuthN enables automatic IAM database authentication. The dialer logs in
+	// with an OAuth2 token of the IAM principal, so any password in the
+	// pgx.ConnConfig is cleared.
+	IAMAuthN bool
+	// IAMPrincipal is the email of the IAM principal used with IAMAuthN. The
+	// Postgres user name is derived from it with IAMUser. When empty, the user
+	// of the pgx.ConnConfig is used instead.
+	IAMPrincipal string
+}
+
+// ConnectAlloyDB creates a new AlloyDBConnector using the provided options.
+func ConnectAlloyDB(ctx context.Context, options ...alloydbconn.Option) (*AlloyDBConnector, error) {
+	// create a new dialer
+	dialer, err := alloydbconn.NewDialer(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AlloyDBConnector{Dialer: dialer}, nil
+}
+
+// Close closes the connector and releases all resources held by the underlying dialer.
+func (x *AlloyDBConnector) Close() error {
+	if x.Dialer == nil {
+		return nil
+	}
+
+	return x.Dialer.Close()
+}
+
+// BeforeConnect is called before a new connection is made. It is passed a copy of the underlying pgx.ConnConfig and
+// will not impact any existing open connections. The host of the config must be an instance URI in the form
+// projects/<project>/locations/<region>/clusters/<cluster>/instances/<instance>.
+func (x *AlloyDBConnector) BeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	if !alloyDBInstancePattern.MatchString(conn.Host) {
+		return fmt.Errorf("pgxgcp: invalid AlloyDB instance URI %q", conn.Host)
+	}
+
+	var options []alloydbconn.DialOption
+
+	if x.IAMAuthN {
+		// the dialer authenticates with a token instead of a password
+		options = append(options, alloydbconn.WithDialIAMAuthN(true))
+		// prepare the config for the IAM login
+		iam(conn, x.IAMPrincipal)
+	}
+
+	// the instance URI is not a DNS name, hand it over to DialFunc unresolved
+	conn.LookupFunc = lookup
+	conn.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+		if x.Dialer == nil {
+			return nil, errNoDialer
+		}
+
+		// use the instance URI from the host field
+		return x.Dialer.Dial(ctx, conn.Host, options...)
+	}
+
+	return nil
+}
+
+// lookup is a pgconn.LookupFunc that returns the host unresolved.
+func lookup(_ context.Context, host string) ([]string, error) {
+	return []string{host}, nil
+}
@@ -0,0 +1,61 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+func ExampleAlloyDBConnector() {
+	// the host must be an AlloyDB instance URI, e.g.
+	// host=projects/<project>/locations/<region>/clusters/<cluster>/instances/<instance>
+	config, err := pgxpool.ParseConfig(os.Getenv("PGX_DATABASE_URL"))
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.TODO()
+	// Create a new pgxgcp.AlloyDBConnector
+	connector, err := pgxgcp.ConnectAlloyDB(ctx)
+	if err != nil {
+		panic(err)
+	}
+	// close the connector
+	defer connector.Close()
+
+	// Set BeforeConnect hook to connector.BeforeConnect
+	config.BeforeConnect = connector.BeforeConnect
+
+	// Create a new pgxpool with the config
+	conn, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		panic(err)
+	}
+	// close the connection
+	defer conn.Close()
+
+	rows, err := conn.Query(ctx, "SELECT * from organization")
+	if err != nil {
+		panic(err)
+	}
+	// close the rows
+	defer rows.Close()
+
+	// Organization struct must be defined
+	type Organization struct {
+		Name string `db:"name"`
+	}
+
+	for rows.Next() {
+		organization, err := pgx.RowToStructByName[Organization](rows)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Println(organization.Name)
+	}
+}
@@ -0,0 +1,155 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"net"
+	"os"
+
+	"cloud.google.com/go/alloydbconn"
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+var _ = Describe("AlloyDBConnector", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("BeforeConnect", func() {
+		It("sets DialFunc and LookupFunc on the conn config", func() {
+			connector := &pgxgcp.AlloyDBConnector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "projects/project/locations/region/clusters/cluster/instances/instance"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+			Expect(conn.LookupFunc).NotTo(BeNil())
+
+			addrs, err := conn.LookupFunc(ctx, conn.Host)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(ConsistOf(conn.Host))
+		})
+
+		It("rejects a malformed instance URI", func() {
+			connector := &pgxgcp.AlloyDBConnector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "projects/project/clusters/cluster"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid AlloyDB instance URI")))
+		})
+
+		It("clears the password in IAM mode", func() {
+			connector := &pgxgcp.AlloyDBConnector{
+				IAMAuthN:     true,
+				IAMPrincipal: "app@project.iam.gserviceaccount.com",
+			}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "projects/project/locations/region/clusters/cluster/instances/instance"
+			conn.Password = "secret"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Password).To(BeEmpty())
+			Expect(conn.User).To(Equal("app@project.iam"))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("DialFunc", func() {
+		It("dials the instance URI through the dialer", func() {
+			address := listen()
+			dialer := &alloyDBDialer{address: address}
+			connector := &pgxgcp.AlloyDBConnector{Dialer: dialer}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "projects/project/locations/region/clusters/cluster/instances/instance"
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			c, err := conn.DialFunc(ctx, "tcp", "")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(c.Close)
+
+			Expect(c.RemoteAddr().String()).To(Equal(address))
+			Expect(dialer.instances).To(ConsistOf(conn.Host))
+		})
+
+		It("fails without a dialer", func() {
+			connector := &pgxgcp.AlloyDBConnector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "projects/project/locations/region/clusters/cluster/instances/instance"
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			_, err := conn.DialFunc(ctx, "tcp", "")
+			Expect(err).To(MatchError(ContainSubstring("connector has no dialer")))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("Close", func() {
+		It("succeeds without a dialer", func() {
+			connector := &pgxgcp.AlloyDBConnector{}
+			Expect(connector.Close()).To(Succeed())
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("Integration", Ordered, func() {
+		var connector *pgxgcp.AlloyDBConnector
+
+		BeforeAll(func() {
+			if os.Getenv("PGXGCP_ALLOYDB_INSTANCE") == "" {
+				Skip("PGXGCP_ALLOYDB_INSTANCE not set")
+			}
+
+			var err error
+			connector, err = pgxgcp.ConnectAlloyDB(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterAll(func() {
+			if connector != nil {
+				Expect(connector.Close()).To(Succeed())
+			}
+		})
+
+		It("ConnectAlloyDB returns a connector with a non-nil Dialer", func() {
+			Expect(connector.Dialer).NotTo(BeNil())
+		})
+
+		It("BeforeConnect sets DialFunc for the AlloyDB instance", func() {
+			conn := &pgx.ConnConfig{}
+			conn.Host = os.Getenv("PGXGCP_ALLOYDB_INSTANCE")
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+	})
+})
+
+// alloyDBDialer is a pgxgcp.AlloyDBDialer that dials a fixed address and
+// records the instances it was asked for.
+type alloyDBDialer struct {
+	address   string
+	instances []string
+}
+
+// Dial implements pgxgcp.AlloyDBDialer.
+func (d *alloyDBDialer) Dial(ctx context.Context, instance string, _ ...alloydbconn.DialOption) (net.Conn, error) {
+	d.instances = append(d.instances, instance)
+
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", d.address)
+}
+
+// Close implements pgxgcp.AlloyDBDialer.
+func (d *alloyDBDialer) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerThreshold is the number of consecutive dial failures that
+	// open the circuit when CircuitBreaker.Threshold is zero.
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is the time the circuit stays open before a probe
+	// dial is let through when CircuitBreaker.Cooldown is zero.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without dialing while the circuit of an instance
+// is open.
+var ErrCircuitOpen = errors.New("pgxgcp: circuit open")
+
+// CircuitBreaker configures the per-instance circuit breaker of a Connector.
+// After Threshold consecutive dial failures the circuit of the instance opens
+// and dials fail fast with ErrCircuitOpen. Once Cooldown has passed, a single
+// probe dial is let through: it closes the circuit on success and opens it
+// again on failure.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive dial failures that open the
+	// circuit. Defaults to DefaultBreakerThreshold.
+	Threshold int
+	// Cooldown is the time the circuit stays open before a probe dial. Defaults
+	// to DefaultBreakerCooldown.
+	Cooldown time.Duration
+}
+
+// breaker tracks the circuit of a single instance.
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	opened   time.Time
+	probing  bool
+}
+
+// allow reports whether a dial may proceed. It lets a single probe through
+// once the cooldown of an open circuit has passed.
+func (b *breaker) allow(cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.opened.IsZero():
+		// closed
+		return true
+	case b.probing, time.Since(b.opened) < cooldown:
+		return false
+	}
+
+	// half-open
+	b.probing = true
+	return true
+}
+
+// record records the outcome of a dial that was allowed.
+func (b *breaker) record(err error, threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.probing
+	b.probing = false
+
+	if err == nil {
+		b.failures = 0
+		b.opened = time.Time{}
+		return
+	}
+
+	b.failures++
+	// a failed probe reopens the circuit right away
+	if probe || b.failures >= threshold {
+		b.opened = time.Now()
+	}
+}
+
+// release lets another probe through after a dial that was abandoned.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// breaker returns the circuit of the instance.
+func (x *Connector) breaker(instance string) *breaker {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.breakers == nil {
+		x.breakers = make(map[string]*breaker)
+	}
+
+	state, ok := x.breakers[instance]
+	if !ok {
+		state = &breaker{}
+		x.breakers[instance] = state
+	}
+
+	return state
+}
+
+// guard dials the instance through its circuit.
+func (p *CircuitBreaker) guard(ctx context.Context, state *breaker, instance string, dial func(context.Context) (net.Conn, error)) (net.Conn, error) {
+	threshold := p.Threshold
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	cooldown := p.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	if !state.allow(cooldown) {
+		return nil, fmt.Errorf("%w for %s", ErrCircuitOpen, instance)
+	}
+
+	conn, err := dial(ctx)
+	// the caller giving up says nothing about the instance
+	if errors.Is(err, context.Canceled) {
+		state.release()
+		return nil, err
+	}
+
+	state.record(err, threshold)
+	return conn, err
+}
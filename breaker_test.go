@@ -0,0 +1,125 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var (
+		ctx       context.Context
+		dialer    *pgxgcptest.Dialer
+		connector *pgxgcp.Connector
+	)
+
+	dial := func(ctx context.Context, host string) error {
+		conn := &pgx.ConnConfig{}
+		conn.Host = host
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+
+	failure := errors.New("maintenance")
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{
+				"project:region:instance": listen(),
+				"project:region:other":    listen(),
+			},
+		}
+		connector = &pgxgcp.Connector{
+			Dialer: dialer,
+			Breaker: &pgxgcp.CircuitBreaker{
+				Threshold: 2,
+				Cooldown:  50 * time.Millisecond,
+			},
+		}
+	})
+
+	It("opens after consecutive failures", func() {
+		dialer.Fail("project:region:instance", failure)
+
+		for range 2 {
+			Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		}
+
+		err := dial(ctx, "project:region:instance")
+		Expect(err).To(MatchError(pgxgcp.ErrCircuitOpen))
+		Expect(err).To(MatchError(ContainSubstring("project:region:instance")))
+		Expect(dialer.Dials("project:region:instance")).To(Equal(2))
+	})
+
+	It("keeps the circuits of other instances closed", func() {
+		dialer.Fail("project:region:instance", failure)
+
+		for range 3 {
+			Expect(dial(ctx, "project:region:instance")).To(HaveOccurred())
+		}
+
+		Expect(dial(ctx, "project:region:other")).To(Succeed())
+	})
+
+	It("resets the failure count on success", func() {
+		dialer.FailTimes("project:region:instance", 1, failure)
+		Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		Expect(dial(ctx, "project:region:instance")).To(Succeed())
+
+		dialer.FailTimes("project:region:instance", 1, failure)
+		Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		Expect(dial(ctx, "project:region:instance")).To(Succeed())
+	})
+
+	It("closes after a successful probe", func() {
+		dialer.FailTimes("project:region:instance", 2, failure)
+
+		for range 2 {
+			Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		}
+		Expect(dial(ctx, "project:region:instance")).To(MatchError(pgxgcp.ErrCircuitOpen))
+
+		Eventually(func() error {
+			return dial(ctx, "project:region:instance")
+		}).WithTimeout(time.Second).WithPolling(10 * time.Millisecond).Should(Succeed())
+		Expect(dialer.Dials("project:region:instance")).To(Equal(3))
+	})
+
+	It("reopens after a failed probe", func() {
+		dialer.Fail("project:region:instance", failure)
+
+		for range 2 {
+			Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		Expect(dial(ctx, "project:region:instance")).To(MatchError(failure))
+		Expect(dial(ctx, "project:region:instance")).To(MatchError(pgxgcp.ErrCircuitOpen))
+		Expect(dialer.Dials("project:region:instance")).To(Equal(3))
+	})
+
+	It("ignores canceled dials", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		dialer.Fail("project:region:instance", context.Canceled)
+
+		for range 3 {
+			Expect(dial(ctx, "project:region:instance")).To(MatchError(context.Canceled))
+		}
+		Expect(dialer.Dials("project:region:instance")).To(Equal(3))
+	})
+})
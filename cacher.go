@@ -2,20 +2,55 @@ package pgxgcp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	"github.com/pgx-contrib/pgxcache"
+	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// firestoreResetBatchSize is the number of documents deleted per page by
+// FirestoreQueryCacher.Reset.
+const firestoreResetBatchSize = 500
+
+// ResetError is returned when a Reset is interrupted or some of the cached
+// records could not be deleted.
+type ResetError struct {
+	// Deleted is the number of records removed before the failure.
+	Deleted int
+	// Cursor is the position from which the reset can be resumed. It is only
+	// set by backends that support resumption.
+	Cursor string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *ResetError) Error() string {
+	return fmt.Sprintf("pgxgcp: reset deleted %d records: %v", e.Deleted, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ResetError) Unwrap() error {
+	return e.Err
+}
+
+// datastoreResetBatchSize is the number of keys deleted per DeleteMulti call by
+// DatastoreQueryCacher.Reset.
+const datastoreResetBatchSize = 500
+
 // FirestoreQuery represents a record in a Firestore collection.
 type FirestoreQuery struct {
 	ID       string    `firestore:"-"`
+	SQL      string    `firestore:"query_sql"`
 	Data     []byte    `firestore:"query_data"`
 	ExpireAt time.Time `firestore:"query_expire_at"`
 }
@@ -28,6 +63,13 @@ type FirestoreQueryCacher struct {
 	Client *firestore.Client
 	// Collection is the name of the collection in Firestore.
 	Collection string
+	// Namespace scopes the cache to a single application. When set, documents
+	// are stored in a sub-collection of Collection named after the namespace,
+	// so Get, Set and Reset never touch another namespace's documents.
+	Namespace string
+	// Encoder encodes the query key into a document ID. Defaults to
+	// EncodeKeySHA256.
+	Encoder KeyEncoder
 }
 
 // Get gets a cache item from Google Firestore. Returns pointer to the item, a boolean
@@ -35,10 +77,10 @@ type FirestoreQueryCacher struct {
 func (r *FirestoreQueryCacher) Get(ctx context.Context, key *pgxcache.QueryKey) (*pgxcache.QueryItem, error) {
 	// create a row
 	row := &FirestoreQuery{
-		ID: key.String(),
+		ID: encodeKey(r.Encoder, key),
 	}
 	// get the item from the collection
-	document, err := r.Client.Collection(r.Collection).Doc(row.ID).Get(ctx)
+	document, err := r.collection().Doc(row.ID).Get(ctx)
 	switch status.Code(err) {
 	case codes.OK:
 		// get the record
@@ -74,21 +116,89 @@ func (r *FirestoreQueryCacher) Set(ctx context.Context, key *pgxcache.QueryKey,
 
 	// prepare the record
 	row := &FirestoreQuery{
-		ID:       key.String(),
+		ID:       encodeKey(r.Encoder, key),
+		SQL:      key.SQL,
 		Data:     data,
 		ExpireAt: time.Now().UTC().Add(ttl),
 	}
 
-	_, err = r.Client.Collection(r.Collection).Doc(row.ID).Set(ctx, row)
+	_, err = r.collection().Doc(row.ID).Set(ctx, row)
 	return err
 }
 
-// Reset implements pgxcache.QueryCacher.
-func (r *FirestoreQueryCacher) Reset(context.Context) error {
-	// TODO: implement this method
+// Reset deletes every query document in the collection. Documents are read in
+// pages and removed through a BulkWriter; a failed delete does not stop the
+// purge, but Reset reports how many documents could not be removed.
+func (r *FirestoreQueryCacher) Reset(ctx context.Context) error {
+	var (
+		deleted int
+		errs    []error
+	)
+
+	// fetch only the document names, the data is not needed to delete them
+	query := r.collection().Select().OrderBy(firestore.DocumentID, firestore.Asc).Limit(firestoreResetBatchSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return &ResetError{Deleted: deleted, Err: errors.Join(append(errs, err)...)}
+		}
+
+		// get the next page of documents
+		documents, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			return &ResetError{Deleted: deleted, Err: errors.Join(append(errs, err)...)}
+		}
+
+		if len(documents) == 0 {
+			break
+		}
+
+		writer := r.Client.BulkWriter(ctx)
+		// enqueue the deletes of the page
+		jobs := make([]*firestore.BulkWriterJob, 0, len(documents))
+		for _, document := range documents {
+			job, err := writer.Delete(document.Ref)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			jobs = append(jobs, job)
+		}
+		// wait for the page to be written
+		writer.End()
+
+		for _, job := range jobs {
+			if _, err := job.Results(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			deleted++
+		}
+
+		if len(documents) < firestoreResetBatchSize {
+			break
+		}
+		// continue after the last document of the page
+		query = query.StartAfter(documents[len(documents)-1])
+	}
+
+	if len(errs) > 0 {
+		return &ResetError{Deleted: deleted, Err: errors.Join(errs...)}
+	}
+
 	return nil
 }
 
+func (r *FirestoreQueryCacher) collection() *firestore.CollectionRef {
+	collection := r.Client.Collection(r.Collection)
+	if r.Namespace != "" {
+		// <collection>/<namespace>/<collection>/<id>
+		collection = collection.Doc(r.Namespace).Collection(r.Collection)
+	}
+
+	return collection
+}
+
 // DatastoreQuery represents a record in a Datastore kind.
 type DatastoreQuery struct {
 	ID       string    `datastore:"-"`
@@ -104,6 +214,10 @@ type DatastoreQueryCacher struct {
 	Client *datastore.Client
 	// Kind is the name of the kind in Datastore.
 	Kind string
+	// Namespace is the Datastore namespace of the entities. It scopes Get, Set
+	// and Reset to a single application; the default namespace is used when
+	// empty.
+	Namespace string
 }
 
 // Get gets a cache item from Google Datastore. Returns pointer to the item, a boolean
@@ -114,7 +228,7 @@ func (r *DatastoreQueryCacher) Get(ctx context.Context, key *pgxcache.QueryKey)
 		ID: key.String(),
 	}
 	// create a new name key
-	name := datastore.NameKey(r.Kind, row.ID, nil)
+	name := r.key(row.ID)
 	// get the item from Datastore
 	err := r.Client.Get(ctx, name, row)
 	switch err {
@@ -152,18 +266,110 @@ func (r *DatastoreQueryCacher) Set(ctx context.Context, key *pgxcache.QueryKey,
 		ExpireAt: time.Now().UTC().Add(ttl),
 	}
 	// create a new name key
-	name := datastore.NameKey(r.Kind, row.ID, nil)
+	name := r.key(row.ID)
 	// set the item into Datastore
 	_, err = r.Client.Put(ctx, name, row)
 	return err
 }
 
-// Reset implements pgxcache.QueryCacher.
-func (r *DatastoreQueryCacher) Reset(context.Context) error {
-	// TODO: implement this method
-	return nil
+// Reset deletes every entity of the kind. It is equivalent to ResetFrom with an
+// empty cursor.
+func (r *DatastoreQueryCacher) Reset(ctx context.Context) error {
+	return r.ResetFrom(ctx, "")
+}
+
+// ResetFrom deletes the entities of the kind starting at the given query
+// cursor. Keys are fetched with a keys-only query and removed with DeleteMulti
+// in batches of 500. On failure the returned *ResetError carries the cursor of
+// the last completed batch, which can be passed back to ResetFrom to continue.
+func (r *DatastoreQueryCacher) ResetFrom(ctx context.Context, cursor string) error {
+	var (
+		deleted int
+		start   datastore.Cursor
+	)
+
+	if cursor != "" {
+		var err error
+		// decode the resume position
+		if start, err = datastore.DecodeCursor(cursor); err != nil {
+			return &ResetError{Cursor: cursor, Err: err}
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return &ResetError{Deleted: deleted, Cursor: cursor, Err: err}
+		}
+
+		query := datastore.NewQuery(r.Kind).Namespace(r.Namespace).KeysOnly().Limit(datastoreResetBatchSize)
+		if cursor != "" {
+			query = query.Start(start)
+		}
+
+		keys := make([]*datastore.Key, 0, datastoreResetBatchSize)
+		// collect the keys of the next batch
+		results := r.Client.Run(ctx, query)
+		for {
+			key, err := results.Next(nil)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return &ResetError{Deleted: deleted, Cursor: cursor, Err: err}
+			}
+			keys = append(keys, key)
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		next, err := results.Cursor()
+		if err != nil {
+			return &ResetError{Deleted: deleted, Cursor: cursor, Err: err}
+		}
+
+		// delete the batch
+		if err := r.Client.DeleteMulti(ctx, keys); err != nil {
+			return &ResetError{Deleted: deleted, Cursor: cursor, Err: err}
+		}
+
+		deleted += len(keys)
+		// move past the deleted batch
+		start, cursor = next, next.String()
+
+		if len(keys) < datastoreResetBatchSize {
+			return nil
+		}
+	}
 }
 
+func (r *DatastoreQueryCacher) key(id string) *datastore.Key {
+	key := datastore.NameKey(r.Kind, id, nil)
+	key.Namespace = r.Namespace
+	return key
+}
+
+const (
+	// storageMetadataKey is the object metadata key set on every object written
+	// by StorageQueryCacher.
+	storageMetadataKey = "pgxgcp"
+	// storageMetadataValue is the value of storageMetadataKey.
+	storageMetadataValue = "query"
+	// storageMetadataSQLKey is the object metadata key holding the SQL of the
+	// query, truncated to storageMetadataSQLLimit.
+	storageMetadataSQLKey = "pgxgcp-sql"
+	// storageMetadataSQLLimit is the maximum length of the SQL stored in the
+	// object metadata, which is limited to 8 KiB in total.
+	storageMetadataSQLLimit = 4096
+	// storageMetadataPrefixKey is the object metadata key holding the Prefix of
+	// the cacher that wrote the object.
+	storageMetadataPrefixKey = "pgxgcp-prefix"
+	// storageResetConcurrency is the maximum number of concurrent deletes issued
+	// by StorageQueryCacher.Reset.
+	storageResetConcurrency = 16
+)
+
 var _ pgxcache.QueryCacher = &StorageQueryCacher{}
 
 // StorageQueryCacher implements pgxcache.QueryCacher interface to use Google Cloud Storage.
@@ -172,12 +378,23 @@ type StorageQueryCacher struct {
 	Client *storage.Client
 	// Bucket is the name of the Cloud Storage bucket.
 	Bucket string
+	// Prefix is prepended to every object name. It scopes Get, Set and Reset to
+	// a single application, e.g. "billing/".
+	Prefix string
+	// Encoder encodes the query key into an object name. Defaults to
+	// EncodeKeySHA256.
+	Encoder KeyEncoder
+	// ResetLegacy makes Reset delete the objects under Prefix that do not record
+	// the prefix they were written with, such as the entries of earlier
+	// versions, which were named after the raw key and carried no metadata.
+	// Only enable it when the cacher is the sole writer under Prefix.
+	ResetLegacy bool
 }
 
 // Get implements pgxcache.QueryCacher.
 func (r *StorageQueryCacher) Get(ctx context.Context, key *pgxcache.QueryKey) (*pgxcache.QueryItem, error) {
 	// create a new entity
-	entity := r.Client.Bucket(r.Bucket).Object(key.String())
+	entity := r.object(encodeKey(r.Encoder, key))
 
 	// check the expiration via CustomTime
 	attr, err := entity.Attrs(ctx)
@@ -223,11 +440,18 @@ func (r *StorageQueryCacher) Set(ctx context.Context, key *pgxcache.QueryKey, it
 	defer cancel()
 
 	// create a new entity
-	entity := r.Client.Bucket(r.Bucket).Object(key.String())
+	entity := r.object(encodeKey(r.Encoder, key))
 	// create a new writer
 	writer := entity.NewWriter(ctx)
 	// set the expiry via CustomTime; the upload is only committed on Close
 	writer.CustomTime = time.Now().UTC().Add(ttl)
+	// mark the object so that Reset can recognise it and keep the SQL for
+	// debugging
+	writer.Metadata = map[string]string{
+		storageMetadataKey:       storageMetadataValue,
+		storageMetadataSQLKey:    truncate(key.SQL, storageMetadataSQLLimit),
+		storageMetadataPrefixKey: r.Prefix,
+	}
 
 	data, err := item.MarshalText()
 	if err != nil {
@@ -242,8 +466,94 @@ func (r *StorageQueryCacher) Set(ctx context.Context, key *pgxcache.QueryKey, it
 	return writer.Close()
 }
 
-// Reset implements pgxcache.QueryCacher.
-func (r *StorageQueryCacher) Reset(context.Context) error {
-	// TODO: implement this method
+// Reset deletes the objects written by the cacher from the bucket. Objects are
+// recognised by the metadata set in Set, including the Prefix they were written
+// with, so unrelated objects and the objects of cachers with another or a
+// nested prefix are left untouched. With ResetLegacy, objects under Prefix
+// without that metadata are deleted as well. Deletes run concurrently and all
+// failures are reported together.
+func (r *StorageQueryCacher) Reset(ctx context.Context) error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		deleted int
+		errs    []error
+	)
+
+	// record the outcome of a single delete
+	done := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch err {
+		case nil, storage.ErrObjectNotExist:
+			deleted++
+		default:
+			errs = append(errs, err)
+		}
+	}
+
+	bucket := r.Client.Bucket(r.Bucket)
+	// list only the attributes needed to recognise and delete an object
+	query := &storage.Query{Prefix: r.Prefix}
+	if err := query.SetAttrSelection([]string{"Name", "Metadata"}); err != nil {
+		return err
+	}
+
+	// limit the number of deletes in flight
+	semaphore := make(chan struct{}, storageResetConcurrency)
+
+	objects := bucket.Objects(ctx, query)
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			done(err)
+			break
+		}
+
+		prefix, scoped := attrs.Metadata[storageMetadataPrefixKey]
+		switch {
+		case scoped && prefix != r.Prefix:
+			// an object of another scope listed under the same prefix
+			continue
+		case scoped && attrs.Metadata[storageMetadataKey] == storageMetadataValue:
+			// an object written by the cacher
+		case !r.ResetLegacy:
+			// an object not written by the cacher, or by an earlier version
+			continue
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			done(err)
+			break
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			done(bucket.Object(name).Delete(ctx))
+		}(attrs.Name)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ResetError{Deleted: deleted, Err: errors.Join(errs...)}
+	}
+
 	return nil
 }
+
+func (r *StorageQueryCacher) object(name string) *storage.ObjectHandle {
+	return r.Client.Bucket(r.Bucket).Object(r.Prefix + name)
+}
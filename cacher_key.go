@@ -0,0 +1,48 @@
+package pgxgcp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pgx-contrib/pgxcache"
+)
+
+// KeyEncoder encodes a query key into a Firestore document ID or a Cloud
+// Storage object name.
+type KeyEncoder func(key *pgxcache.QueryKey) string
+
+var (
+	_ KeyEncoder = EncodeKeySHA256
+	_ KeyEncoder = EncodeKeyBase64
+	_ KeyEncoder = EncodeKeyRaw
+)
+
+// EncodeKeySHA256 encodes the key as the hex encoded SHA-256 digest of its
+// string representation. The result is always 64 characters long. It is the
+// default encoder. Earlier versions used EncodeKeyRaw, so the entries they
+// wrote are missed after an upgrade unless Encoder is set to EncodeKeyRaw.
+func EncodeKeySHA256(key *pgxcache.QueryKey) string {
+	sum := sha256.Sum256([]byte(key.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// EncodeKeyBase64 encodes the key as unpadded base64url of its string
+// representation.
+func EncodeKeyBase64(key *pgxcache.QueryKey) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key.String()))
+}
+
+// EncodeKeyRaw uses the string representation of the key, the fingerprint of
+// its SQL and arguments computed by pgxcache, as is.
+func EncodeKeyRaw(key *pgxcache.QueryKey) string {
+	return key.String()
+}
+
+func encodeKey(encoder KeyEncoder, key *pgxcache.QueryKey) string {
+	if encoder == nil {
+		encoder = EncodeKeySHA256
+	}
+
+	return encoder(key)
+}
@@ -0,0 +1,49 @@
+package pgxgcp_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxcache"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+var _ = Describe("KeyEncoder", func() {
+	var key *pgxcache.QueryKey
+
+	BeforeEach(func() {
+		key = &pgxcache.QueryKey{
+			SQL:  "SELECT * FROM customer WHERE path = '/a/b' AND note = '" + strings.Repeat("x", 2048) + "'",
+			Args: []any{1, "two"},
+		}
+	})
+
+	Describe("EncodeKeySHA256", func() {
+		It("returns a 64 character hex digest", func() {
+			Expect(pgxgcp.EncodeKeySHA256(key)).To(MatchRegexp(`^[0-9a-f]{64}$`))
+		})
+
+		It("is deterministic", func() {
+			other := &pgxcache.QueryKey{SQL: key.SQL, Args: []any{1, "two"}}
+			Expect(pgxgcp.EncodeKeySHA256(key)).To(Equal(pgxgcp.EncodeKeySHA256(other)))
+		})
+
+		It("differs for different arguments", func() {
+			other := &pgxcache.QueryKey{SQL: key.SQL, Args: []any{2, "two"}}
+			Expect(pgxgcp.EncodeKeySHA256(key)).NotTo(Equal(pgxgcp.EncodeKeySHA256(other)))
+		})
+	})
+
+	Describe("EncodeKeyBase64", func() {
+		It("returns a URL safe encoding without slashes", func() {
+			Expect(pgxgcp.EncodeKeyBase64(key)).To(MatchRegexp(`^[A-Za-z0-9_-]+$`))
+		})
+	})
+
+	Describe("EncodeKeyRaw", func() {
+		It("returns the key string", func() {
+			Expect(pgxgcp.EncodeKeyRaw(key)).To(Equal(key.String()))
+		})
+	})
+})
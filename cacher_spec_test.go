@@ -2,6 +2,7 @@ package pgxgcp_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -15,6 +16,14 @@ import (
 	"github.com/pgx-contrib/pgxgcp"
 )
 
+var _ = Describe("ResetError", func() {
+	It("reports the number of deleted records", func() {
+		err := &pgxgcp.ResetError{Deleted: 3, Err: context.Canceled}
+		Expect(err.Error()).To(ContainSubstring("deleted 3 records"))
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
 var _ = Describe("FirestoreQueryCacher", func() {
 	// -------------------------------------------------------------------------
 	Describe("Integration", Ordered, func() {
@@ -77,8 +86,44 @@ var _ = Describe("FirestoreQueryCacher", func() {
 			Expect(got).To(BeNil())
 		})
 
-		It("Reset returns nil", func() {
+		It("Reset removes every cached item", func() {
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(cacher.Set(ctx, key, item, time.Minute)).To(Succeed())
 			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+		})
+
+		It("scopes entries to the namespace", func() {
+			scoped := *cacher
+			scoped.Namespace = "pgxgcp-test"
+
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(scoped.Set(ctx, key, item, time.Minute)).To(Succeed())
+			DeferCleanup(func() { _ = scoped.Reset(context.Background()) })
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+
+			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err = scoped.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).NotTo(BeNil())
+		})
+
+		It("Reset stops when the context is cancelled", func() {
+			cctx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			err := cacher.Reset(cctx)
+			Expect(err).To(MatchError(context.Canceled))
+
+			var rerr *pgxgcp.ResetError
+			Expect(errors.As(err, &rerr)).To(BeTrue())
 		})
 	})
 })
@@ -145,8 +190,43 @@ var _ = Describe("DatastoreQueryCacher", func() {
 			Expect(got).To(BeNil())
 		})
 
-		It("Reset returns nil", func() {
+		It("Reset removes every cached item", func() {
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(cacher.Set(ctx, key, item, time.Minute)).To(Succeed())
 			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+		})
+
+		It("scopes entries to the namespace", func() {
+			scoped := *cacher
+			scoped.Namespace = "pgxgcp-test"
+
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(scoped.Set(ctx, key, item, time.Minute)).To(Succeed())
+			DeferCleanup(func() { _ = scoped.Reset(context.Background()) })
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+
+			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err = scoped.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).NotTo(BeNil())
+		})
+
+		It("ResetFrom rejects a malformed cursor", func() {
+			err := cacher.ResetFrom(ctx, "not-a-cursor")
+			Expect(err).To(HaveOccurred())
+
+			var rerr *pgxgcp.ResetError
+			Expect(errors.As(err, &rerr)).To(BeTrue())
+			Expect(rerr.Deleted).To(BeZero())
+			Expect(rerr.Cursor).To(Equal("not-a-cursor"))
 		})
 	})
 })
@@ -212,8 +292,87 @@ var _ = Describe("StorageQueryCacher", func() {
 			Expect(got).To(BeNil())
 		})
 
-		It("Reset returns nil", func() {
+		It("Reset removes every cached item", func() {
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(cacher.Set(ctx, key, item, time.Minute)).To(Succeed())
 			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+		})
+
+		It("scopes entries to the prefix", func() {
+			scoped := *cacher
+			scoped.Prefix = "pgxgcp-test/"
+
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(scoped.Set(ctx, key, item, time.Minute)).To(Succeed())
+			DeferCleanup(func() { _ = scoped.Reset(context.Background()) })
+
+			got, err := cacher.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).To(BeNil())
+
+			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			got, err = scoped.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).NotTo(BeNil())
+		})
+
+		It("Reset leaves the entries of a longer prefix", func() {
+			short := *cacher
+			short.Prefix = "pgxgcp-test"
+
+			long := *cacher
+			long.Prefix = "pgxgcp-test2/"
+
+			item := &pgxcache.QueryItem{CommandTag: "SELECT"}
+			Expect(long.Set(ctx, key, item, time.Minute)).To(Succeed())
+			DeferCleanup(func() { _ = long.Reset(context.Background()) })
+
+			Expect(short.Reset(ctx)).To(Succeed())
+
+			got, err := long.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(got).NotTo(BeNil())
+		})
+
+		It("Reset leaves objects not written by the cacher", func() {
+			name := fmt.Sprintf("pgxgcp-foreign-%d", time.Now().UnixNano())
+			object := client.Bucket(cacher.Bucket).Object(name)
+
+			writer := object.NewWriter(ctx)
+			_, err := writer.Write([]byte("foreign"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			DeferCleanup(func() { _ = object.Delete(context.Background()) })
+
+			Expect(cacher.Reset(ctx)).To(Succeed())
+
+			_, err = object.Attrs(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Reset removes objects of earlier versions with ResetLegacy", func() {
+			legacy := *cacher
+			legacy.Prefix = "pgxgcp-legacy/"
+			legacy.ResetLegacy = true
+
+			// an entry named after the raw key, without metadata
+			object := client.Bucket(cacher.Bucket).Object(legacy.Prefix + pgxgcp.EncodeKeyRaw(key))
+
+			writer := object.NewWriter(ctx)
+			_, err := writer.Write([]byte("legacy"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			DeferCleanup(func() { _ = object.Delete(context.Background()) })
+
+			Expect(legacy.Reset(ctx)).To(Succeed())
+
+			_, err = object.Attrs(ctx)
+			Expect(err).To(MatchError(storage.ErrObjectNotExist))
 		})
 	})
 })
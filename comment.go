@@ -0,0 +1,215 @@
+package pgxgcp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pgx-contrib/pgxcache"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sqlcommenter tags understood by Cloud SQL Query Insights.
+const (
+	// TagRoute is the tag of the route that issued the query, e.g. /orders/:id.
+	TagRoute = "route"
+	// TagController is the tag of the controller that issued the query.
+	TagController = "controller"
+	// TagAction is the tag of the controller action that issued the query.
+	TagAction = "action"
+	// TagFramework is the tag of the framework that issued the query.
+	TagFramework = "framework"
+	// TagTraceparent is the tag of the W3C trace context of the query.
+	TagTraceparent = "traceparent"
+)
+
+// tagsKey is the context key of the sqlcommenter tags.
+type tagsKey struct{}
+
+// WithTags returns a copy of ctx that carries the given sqlcommenter tags in
+// addition to those already in ctx.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := maps.Clone(Tags(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(tags))
+	}
+	maps.Copy(merged, tags)
+
+	return context.WithValue(ctx, tagsKey{}, merged)
+}
+
+// Tags returns the sqlcommenter tags carried by ctx.
+func Tags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+var _ pgxcache.Queryable = &Commenter{}
+
+// Commenter is a querier that appends a sqlcommenter comment to each statement
+// with the tags of the context, the static Tags and the traceparent of the
+// OpenTelemetry span in the context, so Cloud SQL Query Insights can link a
+// query to its route and trace.
+//
+// Only the route, controller and similar tags are stable, so statements with a
+// traceparent are executed with TraceMode, which by default does not add them
+// to the statement cache of the connection. When used with pgxcache, the
+// Commenter must be the Querier of the pgxcache.Querier so the cache key is
+// derived from the uncommented SQL. Batches and COPY are passed through
+// unchanged.
+type Commenter struct {
+	// Querier is the underlying querier, such as a *pgxpool.Pool.
+	Querier pgxcache.Queryable
+	// Tags are the static tags added to every statement, e.g. the framework.
+	// Tags of the context take precedence.
+	Tags map[string]string
+	// TraceMode is the exec mode of statements with a traceparent. Defaults to
+	// pgx.QueryExecModeExec, which sends the statement in a single round trip
+	// without preparing it.
+	TraceMode pgx.QueryExecMode
+}
+
+// Begin implements pgxcache.Queryable. The statements of the transaction are
+// commented as well.
+func (x *Commenter) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := x.Querier.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commenterTx{Tx: tx, commenter: x}, nil
+}
+
+// Exec implements pgxcache.Queryable.
+func (x *Commenter) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	query, args = x.comment(ctx, query, args)
+	return x.Querier.Exec(ctx, query, args...)
+}
+
+// Query implements pgxcache.Queryable.
+func (x *Commenter) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	query, args = x.comment(ctx, query, args)
+	return x.Querier.Query(ctx, query, args...)
+}
+
+// QueryRow implements pgxcache.Queryable.
+func (x *Commenter) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	query, args = x.comment(ctx, query, args)
+	return x.Querier.QueryRow(ctx, query, args...)
+}
+
+// SendBatch implements pgxcache.Queryable.
+func (x *Commenter) SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults {
+	return x.Querier.SendBatch(ctx, batch)
+}
+
+// CopyFrom implements pgxcache.Queryable.
+func (x *Commenter) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, source pgx.CopyFromSource) (int64, error) {
+	return x.Querier.CopyFrom(ctx, table, columns, source)
+}
+
+// comment appends the comment to the query and selects the exec mode of a
+// statement with a traceparent.
+func (x *Commenter) comment(ctx context.Context, query string, args []any) (string, []any) {
+	// leave statements that are already commented alone
+	if strings.Contains(query, "/*") {
+		return query, args
+	}
+
+	tags := maps.Clone(x.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	maps.Copy(tags, Tags(ctx))
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		tags[TagTraceparent] = fmt.Sprintf("00-%s-%s-%s", span.TraceID(), span.SpanID(), span.TraceFlags())
+
+		mode := x.TraceMode
+		if mode == 0 {
+			mode = pgx.QueryExecModeExec
+		}
+		// an exec mode passed by the caller comes later and wins
+		args = append([]any{mode}, args...)
+	}
+
+	if len(tags) == 0 {
+		return query, args
+	}
+
+	return Comment(query, tags), args
+}
+
+// Comment appends a sqlcommenter comment with the given tags to the query. The
+// keys are sorted and the keys and values URL-encoded as the sqlcommenter
+// specification requires.
+func Comment(query string, tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		// escaping also keeps quotes and the end of the comment out of the values
+		pairs = append(pairs, url.PathEscape(key)+"='"+url.PathEscape(tags[key])+"'")
+	}
+
+	comment := "/*" + strings.Join(pairs, ",") + "*/"
+
+	// the comment goes before a terminating semicolon
+	trimmed := strings.TrimRight(query, " \t\r\n")
+	if body, ok := strings.CutSuffix(trimmed, ";"); ok {
+		return body + separator(body) + comment + ";"
+	}
+
+	return trimmed + separator(trimmed) + comment
+}
+
+// separator returns the separator between the query and its comment, a new
+// line when the last line of the query ends in a line comment.
+func separator(query string) string {
+	if index := strings.LastIndexByte(query, '\n'); index >= 0 {
+		query = query[index+1:]
+	}
+
+	if strings.Contains(query, "--") {
+		return "\n"
+	}
+
+	return " "
+}
+
+// commenterTx is a transaction whose statements are commented.
+type commenterTx struct {
+	pgx.Tx
+	commenter *Commenter
+}
+
+// Begin implements pgx.Tx.
+func (tx *commenterTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	nested, err := tx.Tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commenterTx{Tx: nested, commenter: tx.commenter}, nil
+}
+
+// Exec implements pgx.Tx.
+func (tx *commenterTx) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	query, args = tx.commenter.comment(ctx, query, args)
+	return tx.Tx.Exec(ctx, query, args...)
+}
+
+// Query implements pgx.Tx.
+func (tx *commenterTx) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	query, args = tx.commenter.comment(ctx, query, args)
+	return tx.Tx.Query(ctx, query, args...)
+}
+
+// QueryRow implements pgx.Tx.
+func (tx *commenterTx) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	query, args = tx.commenter.comment(ctx, query, args)
+	return tx.Tx.QueryRow(ctx, query, args...)
+}
@@ -0,0 +1,155 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxcache"
+	"github.com/pgx-contrib/pgxgcp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recorder is a querier that records the statements it executes.
+type recorder struct {
+	pgx.Tx
+
+	query string
+	args  []any
+}
+
+func (r *recorder) Begin(context.Context) (pgx.Tx, error) {
+	return r, nil
+}
+
+func (r *recorder) Exec(_ context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	r.query, r.args = query, args
+	return pgconn.NewCommandTag("SELECT 1"), nil
+}
+
+var _ = Describe("Comment", func() {
+	tags := map[string]string{"route": "/orders/:id", "framework": "net/http"}
+
+	DescribeTable("appends the sqlcommenter comment",
+		func(query, commented string) {
+			Expect(pgxgcp.Comment(query, tags)).To(Equal(commented))
+		},
+		Entry("plain", "SELECT 1", "SELECT 1 /*framework='net%2Fhttp',route='%2Forders%2F:id'*/"),
+		Entry("semicolon", "SELECT 1;\n", "SELECT 1 /*framework='net%2Fhttp',route='%2Forders%2F:id'*/;"),
+		Entry("line comment", "SELECT 1 -- one", "SELECT 1 -- one\n/*framework='net%2Fhttp',route='%2Forders%2F:id'*/"),
+	)
+
+	It("escapes quotes and the end of the comment", func() {
+		Expect(pgxgcp.Comment("SELECT 1", map[string]string{"action": "it's */"})).To(Equal("SELECT 1 /*action='it%27s%20%2A%2F'*/"))
+	})
+})
+
+var _ = Describe("Commenter", func() {
+	var (
+		ctx       context.Context
+		querier   *recorder
+		commenter *pgxgcp.Commenter
+	)
+
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		querier = &recorder{}
+		commenter = &pgxgcp.Commenter{
+			Querier: querier,
+			Tags:    map[string]string{pgxgcp.TagFramework: "chi", pgxgcp.TagRoute: "default"},
+		}
+	})
+
+	It("adds the tags of the context", func() {
+		ctx = pgxgcp.WithTags(ctx, map[string]string{pgxgcp.TagRoute: "/orders"})
+		ctx = pgxgcp.WithTags(ctx, map[string]string{pgxgcp.TagController: "orders"})
+
+		_, err := commenter.Exec(ctx, "SELECT $1", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.query).To(Equal("SELECT $1 /*controller='orders',framework='chi',route='%2Forders'*/"))
+		Expect(querier.args).To(Equal([]any{1}))
+	})
+
+	It("adds the traceparent without caching the statement", func() {
+		ctx = trace.ContextWithSpanContext(ctx, span)
+
+		_, err := commenter.Exec(ctx, "SELECT $1", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.query).To(ContainSubstring("traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'"))
+		Expect(querier.args).To(Equal([]any{pgx.QueryExecModeExec, 1}))
+	})
+
+	It("uses the configured trace mode", func() {
+		commenter.TraceMode = pgx.QueryExecModeSimpleProtocol
+		ctx = trace.ContextWithSpanContext(ctx, span)
+
+		_, err := commenter.Exec(ctx, "SELECT $1", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.args).To(Equal([]any{pgx.QueryExecModeSimpleProtocol, 1}))
+	})
+
+	It("leaves commented statements alone", func() {
+		_, err := commenter.Exec(ctx, "SELECT 1 /* mine */")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.query).To(Equal("SELECT 1 /* mine */"))
+	})
+
+	It("leaves statements without tags alone", func() {
+		commenter.Tags = nil
+
+		_, err := commenter.Exec(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.query).To(Equal("SELECT 1"))
+	})
+
+	It("comments the statements of a transaction", func() {
+		tx, err := commenter.Begin(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = tx.Exec(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(querier.query).To(Equal("SELECT 1 /*framework='chi',route='default'*/"))
+	})
+
+	It("keeps the pgxcache key stable", func() {
+		cacher := &countingCacher{}
+		cached := &pgxcache.Querier{Querier: commenter, Cacher: cacher}
+
+		for _, traced := range []trace.SpanContext{span, span.WithTraceFlags(0)} {
+			_, err := cached.Exec(trace.ContextWithSpanContext(ctx, traced), "SELECT $1", 1)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(cacher.keys).To(HaveLen(2))
+		Expect(cacher.keys[0].SQL).To(Equal("SELECT $1"))
+		Expect(cacher.keys[1]).To(Equal(cacher.keys[0]))
+	})
+})
+
+// countingCacher is a pgxcache.QueryCacher that records the keys it is asked
+// for and never hits.
+type countingCacher struct {
+	keys []pgxcache.QueryKey
+}
+
+func (c *countingCacher) Get(_ context.Context, key *pgxcache.QueryKey) (*pgxcache.QueryItem, error) {
+	c.keys = append(c.keys, *key)
+	return nil, nil
+}
+
+func (c *countingCacher) Set(context.Context, *pgxcache.QueryKey, *pgxcache.QueryItem, time.Duration) error {
+	return nil
+}
+
+func (c *countingCacher) Reset(context.Context) error {
+	return nil
+}
@@ -2,41 +2,378 @@ package pgxgcp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/cloudsqlconn"
+	"cloud.google.com/go/compute/metadata"
 	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	// instanceNamePattern matches a Cloud SQL instance connection name,
+	// including legacy domain-scoped projects. Project, region and instance
+	// names consist of lowercase letters, digits and hyphens.
+	instanceNamePattern = regexp.MustCompile(`^(?:[a-z0-9][a-z0-9.-]*:)?[a-z0-9][a-z0-9-]*:[a-z0-9][a-z0-9-]*:[a-z0-9][a-z0-9-]*$`)
+	// instanceDNSSuffixes are the suffixes of Cloud SQL instance DNS names.
+	instanceDNSSuffixes = []string{".sql.goog", ".sql-psa.goog", ".sql-psc.goog"}
+)
+
+// Dialer dials Cloud SQL instances by their instance connection name. It is
+// implemented by *cloudsqlconn.Dialer; the pgxgcptest package provides a fake
+// for tests.
+type Dialer interface {
+	// Dial returns a connection to the given instance.
+	Dial(ctx context.Context, instance string, options ...cloudsqlconn.DialOption) (net.Conn, error)
+	// Close releases the resources held by the dialer.
+	Close() error
+}
+
+var _ Dialer = &cloudsqlconn.Dialer{}
+
+// errNoDialer is returned when an instance must be dialed but the Connector
+// has no Dialer.
+var errNoDialer = errors.New("pgxgcp: connector has no dialer")
+
 // Connector connects to a Cloud SQL instance using the Cloud SQL Proxy.
 type Connector struct {
 	// Dialer is the underlying dialer used to connect to the Cloud SQL instance.
-	Dialer *cloudsqlconn.Dialer
+	Dialer Dialer
+	// IAMAuthN enables automatic IAM database authentication. The dialer logs in
+	// with an OAuth2 token of the IAM principal, so any password in the
+	// pgx.ConnConfig is cleared.
+	IAMAuthN bool
+	// IAMPrincipal is the email of the IAM principal used with IAMAuthN. The
+	// Postgres user name is derived from it with IAMUser. When empty, the user
+	// of the pgx.ConnConfig is used instead.
+	IAMPrincipal string
+	// DomainNames are DNS names that resolve to Cloud SQL instances, for use with
+	// a dialer created with cloudsqlconn.WithDNSResolver.
+	DomainNames []string
+	// InstanceDNSNames dials every host ending in .sql.goog, .sql-psa.goog or
+	// .sql-psc.goog through the Dialer, which must then be created with
+	// cloudsqlconn.WithDNSResolver. When false, such hosts are left to pgx
+	// unless they are listed in DomainNames.
+	InstanceDNSNames bool
+	// Failover maps a logical database host to an ordered list of candidate
+	// instance connection names, such as a primary followed by its cross-region
+	// disaster recovery replicas. A config whose host is a key of the map dials
+	// the active candidate and moves on to the next one after
+	// FailoverThreshold consecutive failures or when the node turns out to be in
+	// recovery.
+	Failover map[string][]string
+	// FailoverThreshold is the number of consecutive dial failures after which
+	// the next candidate becomes active. Defaults to DefaultFailoverThreshold.
+	FailoverThreshold int
+	// OnFailover is called when the active instance of a logical database
+	// changes.
+	OnFailover func(FailoverEvent)
+	// Instances holds per-instance dial settings keyed by instance connection
+	// name, e.g. to reach some instances through Private Service Connect and
+	// others through their public IP with the same Connector.
+	Instances map[string]InstanceConfig
+	// IPType selects the IP address dialed for instances without an IP type in
+	// Instances. The default of the dialer is used when empty. ParseConfig sets
+	// it from the ip_type parameter.
+	IPType IPType
+	// Overrides redirects instance connection names to plain TCP addresses
+	// (host:port) or Unix socket directories, e.g. to a local Postgres server
+	// during development. Connect and ParseConfig populate it from
+	// InstanceOverridesEnv.
+	Overrides map[string]string
+	// SocketDir enables the Cloud SQL Auth Proxy sidecar mode. When set, an
+	// instance is dialed at the Unix socket the proxy exposes for it,
+	// <SocketDir>/<instance>/.s.PGSQL.5432, instead of through the Dialer,
+	// which may then be nil. Cloud Run and the proxy default to DefaultSocketDir.
+	SocketDir string
+
+	// Retry retries dials that fail with a retryable error. Dials are not
+	// retried when nil.
+	Retry *RetryPolicy
+	// Breaker fails dials fast while an instance keeps failing, see
+	// CircuitBreaker. There is no circuit breaker when nil.
+	Breaker *CircuitBreaker
+
+	// MeterProvider provides the meter used to record dial metrics. Defaults to
+	// the global OpenTelemetry meter provider.
+	MeterProvider metric.MeterProvider
+	// TracerProvider provides the tracer used to record a span for each dial.
+	// Defaults to the global OpenTelemetry tracer provider.
+	TracerProvider trace.TracerProvider
+
+	mu        sync.Mutex
+	failovers map[string]*failover
+	breakers  map[string]*breaker
+	meter     *connectorMetrics
 }
 
 // Connect creates a new Connector using the provided options.
 func Connect(ctx context.Context, options ...cloudsqlconn.Option) (*Connector, error) {
+	// read the development overrides
+	overrides, err := overridesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	// create a new dialer
 	dialer, err := cloudsqlconn.NewDialer(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Connector{Dialer: dialer}, nil
+	return &Connector{Dialer: dialer, Overrides: overrides}, nil
 }
 
 // Close closes the connector and releases all resources held by the underlying dialer.
 func (x *Connector) Close() error {
+	if x.Dialer == nil {
+		return nil
+	}
+
 	return x.Dialer.Close()
 }
 
 // BeforeConnect is called before a new connection is made. It is passed a copy of the underlying pgx.ConnConfig and
-// will not impact any existing open connections.
+// will not impact any existing open connections. Hosts that are neither a Cloud SQL instance connection name nor one
+// of the DomainNames (or an instance DNS name with InstanceDNSNames) are left to the default pgx dialer, so the same config can point at localhost in development.
+// Hosts listed in Overrides are rewritten to their local address and dialed by pgx as well.
 func (x *Connector) BeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	// an overridden instance is dialed by pgx at its local address
+	if ok, err := x.override(conn); ok || err != nil {
+		return err
+	}
+
+	ok, err := x.match(conn.Host)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		// not a Cloud SQL host, keep the default dialer
+		return nil
+	}
+
+	if x.IAMAuthN {
+		// prepare the config for the IAM login
+		iam(conn, x.IAMPrincipal)
+	}
+
+	// the instance name is not a DNS name, hand it over to DialFunc unresolved
+	conn.LookupFunc = lookup
+
+	if state := x.failover(conn.Host); state != nil {
+		return x.failoverConnect(conn, state)
+	}
+
 	conn.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
 		// use the instance name from the host field
-		return x.Dialer.Dial(ctx, conn.Host)
+		return x.dial(ctx, conn.Host)
 	}
 
 	return nil
 }
+
+// Active returns the active instance connection name of a logical database
+// host from Failover. For any other host it returns the host unchanged.
+func (x *Connector) Active(host string) string {
+	if state := x.failover(host); state != nil {
+		return state.current()
+	}
+
+	return host
+}
+
+// dial connects to the given instance through its circuit breaker, retrying
+// failed dials according to the Retry policy.
+func (x *Connector) dial(ctx context.Context, instance string) (net.Conn, error) {
+	if x.Breaker == nil {
+		return x.retry(ctx, instance)
+	}
+
+	return x.Breaker.guard(ctx, x.breaker(instance), instance, func(ctx context.Context) (net.Conn, error) {
+		return x.retry(ctx, instance)
+	})
+}
+
+// retry dials the given instance according to the Retry policy.
+func (x *Connector) retry(ctx context.Context, instance string) (net.Conn, error) {
+	if x.Retry == nil {
+		return x.attempt(ctx, instance)
+	}
+
+	return x.Retry.retry(ctx, instance, func(ctx context.Context) (net.Conn, error) {
+		return x.attempt(ctx, instance)
+	})
+}
+
+// attempt makes a single dial to the given instance, recording a span and the
+// dial metrics.
+func (x *Connector) attempt(ctx context.Context, instance string) (net.Conn, error) {
+	metrics := x.metrics()
+
+	ctx, span := x.startDial(ctx, instance)
+	start := time.Now()
+	conn, err := x.connect(ctx, instance)
+	endDial(span, err)
+	// record the outcome of the dial
+	metrics.dialed(ctx, instance, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics.track(ctx, instance, conn), nil
+}
+
+// dialer reports whether the instance is dialed through the Dialer rather than
+// an override or a proxy socket.
+func (x *Connector) dialer(instance string) bool {
+	_, ok := x.Overrides[instance]
+	return !ok && x.SocketDir == ""
+}
+
+// connect opens a connection to the given instance at its override, its proxy
+// socket or through the dialer.
+func (x *Connector) connect(ctx context.Context, instance string) (net.Conn, error) {
+	if address, ok := x.Overrides[instance]; ok {
+		return dialOverride(ctx, address)
+	}
+
+	if x.SocketDir != "" {
+		return dialSocket(ctx, x.SocketDir, instance)
+	}
+
+	options, err := x.options(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.Dialer == nil {
+		return nil, errNoDialer
+	}
+
+	return x.Dialer.Dial(ctx, instance, options...)
+}
+
+// options returns the dial options of the given instance.
+func (x *Connector) options(instance string) ([]cloudsqlconn.DialOption, error) {
+	var options []cloudsqlconn.DialOption
+
+	if x.IAMAuthN {
+		// the dialer authenticates with a token instead of a password
+		options = append(options, cloudsqlconn.WithDialIAMAuthN(true))
+	}
+
+	if x.IPType != "" {
+		option, err := x.IPType.option()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	if config, ok := x.Instances[instance]; ok {
+		// the endpoint override only applies to Private Service Connect dials
+		if config.PSCHost != "" && x.ipType(instance) != IPTypePSC {
+			return nil, fmt.Errorf("pgxgcp: instance %q has a PSCHost but does not use the %q ip type", instance, IPTypePSC)
+		}
+
+		// apply the per-instance settings, later options win
+		extra, err := config.options()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, extra...)
+	}
+
+	return options, nil
+}
+
+// match reports whether the host must be dialed through the Cloud SQL dialer.
+// It returns an error for hosts that look like a malformed instance connection
+// name.
+func (x *Connector) match(host string) (bool, error) {
+	switch {
+	case host == "":
+		return false, nil
+	case strings.HasPrefix(host, "/"):
+		// unix socket directory
+		return false, nil
+	case net.ParseIP(host) != nil:
+		// IPv4 or IPv6 address
+		return false, nil
+	case slices.Contains(x.DomainNames, host):
+		return true, nil
+	case len(x.Failover[host]) > 0:
+		return true, nil
+	case strings.Contains(host, ":"):
+		if !instanceNamePattern.MatchString(host) {
+			return false, fmt.Errorf("pgxgcp: invalid Cloud SQL instance connection name %q, expected PROJECT:REGION:INSTANCE", host)
+		}
+		return true, nil
+	}
+
+	if !x.InstanceDNSNames {
+		return false, nil
+	}
+
+	name := strings.TrimSuffix(host, ".")
+	// Cloud SQL instance DNS names
+	for _, suffix := range instanceDNSSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// IsInstanceConnectionName reports whether name is a well-formed Cloud SQL
+// instance connection name, such as project:region:instance or the legacy
+// domain-scoped example.com:project:region:instance.
+func IsInstanceConnectionName(name string) bool {
+	return instanceNamePattern.MatchString(name)
+}
+
+// IAMUser returns the Postgres user name of the given IAM principal email.
+// Service account emails are trimmed of their ".gserviceaccount.com" suffix,
+// as required by Cloud SQL; user emails are returned unchanged.
+func IAMUser(email string) string {
+	return strings.TrimSuffix(email, ".gserviceaccount.com")
+}
+
+// iam prepares the conn config for an IAM database login.
+func iam(conn *pgx.ConnConfig, principal string) {
+	if principal != "" {
+		conn.User = principal
+	}
+
+	conn.User = IAMUser(conn.User)
+	conn.Password = ""
+}
+
+// DefaultIAMPrincipal returns the email of the default service account from
+// the metadata server. It is available on Cloud Run, GKE and Compute Engine,
+// and can be assigned to Connector.IAMPrincipal.
+func DefaultIAMPrincipal(ctx context.Context) (string, error) {
+	return metadata.EmailWithContext(ctx, "default")
+}
+
+// trackedConn is a net.Conn that calls done once when it is closed.
+type trackedConn struct {
+	net.Conn
+	once sync.Once
+	done func()
+}
+
+// Close implements net.Conn.
+func (c *trackedConn) Close() error {
+	c.once.Do(c.done)
+	return c.Conn.Close()
+}
@@ -53,3 +53,29 @@ func ExampleConnector() {
 		fmt.Println(organization.Name)
 	}
 }
+
+func ExampleParseConfig() {
+	ctx := context.TODO()
+	// e.g. cloudsql://app@project.iam@project:region:instance/app?ip_type=private&iam=true
+	config, connector, err := pgxgcp.ParseConfig(ctx, os.Getenv("PGX_DATABASE_URL"))
+	if err != nil {
+		panic(err)
+	}
+	// close the connector
+	defer connector.Close()
+
+	// Create a new pgxpool with the config
+	conn, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		panic(err)
+	}
+	// close the connection
+	defer conn.Close()
+
+	var name string
+	if err := conn.QueryRow(ctx, "SELECT current_user").Scan(&name); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(name)
+}
@@ -2,12 +2,17 @@ package pgxgcp_test
 
 import (
 	"context"
+	"errors"
+	"net"
 	"os"
+	"strconv"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
 )
 
 var _ = Describe("Connector", func() {
@@ -29,11 +34,262 @@ var _ = Describe("Connector", func() {
 			Expect(conn.DialFunc).NotTo(BeNil())
 		})
 
-		It("always returns nil", func() {
+		It("resolves the instance name to itself", func() {
 			connector := &pgxgcp.Connector{}
 
 			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.LookupFunc).NotTo(BeNil())
+
+			addrs, err := conn.LookupFunc(ctx, conn.Host)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addrs).To(ConsistOf("project:region:instance"))
+		})
+
+		It("accepts domain-scoped instance names", func() {
+			connector := &pgxgcp.Connector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "example.com:project:region:instance"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+
+		It("accepts instance DNS names when enabled", func() {
+			connector := &pgxgcp.Connector{InstanceDNSNames: true}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "instance.project.region.sql.goog."
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+
+		It("keeps the default dialer for instance DNS names by default", func() {
+			connector := &pgxgcp.Connector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "instance.project.region.sql.goog."
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).To(BeNil())
+		})
+
+		It("accepts configured domain names", func() {
+			connector := &pgxgcp.Connector{DomainNames: []string{"db.example.com"}}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "db.example.com"
+
 			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+
+		DescribeTable("keeps the default dialer for other hosts",
+			func(host string) {
+				connector := &pgxgcp.Connector{}
+
+				conn := &pgx.ConnConfig{}
+				conn.Host = host
+
+				Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+				Expect(conn.DialFunc).To(BeNil())
+				Expect(conn.LookupFunc).To(BeNil())
+			},
+			Entry("empty", ""),
+			Entry("localhost", "localhost"),
+			Entry("hostname", "db.example.com"),
+			Entry("IPv4", "127.0.0.1"),
+			Entry("IPv6", "::1"),
+			Entry("unix socket", "/var/run/postgresql"),
+		)
+
+		DescribeTable("rejects malformed instance names",
+			func(host string) {
+				connector := &pgxgcp.Connector{}
+
+				conn := &pgx.ConnConfig{}
+				conn.Host = host
+
+				Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid Cloud SQL instance connection name")))
+			},
+			Entry("missing region", "project:instance"),
+			Entry("empty part", "project::instance"),
+			Entry("too many parts", "a:b:c:d:e"),
+		)
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("IsInstanceConnectionName", func() {
+		It("accepts project:region:instance", func() {
+			Expect(pgxgcp.IsInstanceConnectionName("project:region:instance")).To(BeTrue())
+		})
+
+		It("rejects a host name", func() {
+			Expect(pgxgcp.IsInstanceConnectionName("localhost")).To(BeFalse())
+		})
+
+		DescribeTable("rejects characters outside of GCP names",
+			func(name string) {
+				Expect(pgxgcp.IsInstanceConnectionName(name)).To(BeFalse())
+			},
+			Entry("query", "project:region:instance?iam=true"),
+			Entry("userinfo", "user@project:region:instance"),
+			Entry("uppercase", "Project:region:instance"),
+			Entry("space", "project:region:my instance"),
+		)
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("DialFunc", func() {
+		var (
+			address string
+			dialer  *pgxgcptest.Dialer
+		)
+
+		BeforeEach(func() {
+			address = listen()
+			dialer = &pgxgcptest.Dialer{
+				Instances: map[string]string{"project:region:instance": address},
+			}
+		})
+
+		It("dials the instance through the dialer", func() {
+			connector := &pgxgcp.Connector{Dialer: dialer}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			c, err := conn.DialFunc(ctx, "tcp", "project:region:instance:5432")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(c.Close)
+
+			Expect(c.RemoteAddr().String()).To(Equal(address))
+			Expect(dialer.Dials("project:region:instance")).To(Equal(1))
+		})
+
+		It("returns the dialer error", func() {
+			failure := errors.New("refresh failed")
+			dialer.Fail("project:region:instance", failure)
+
+			connector := &pgxgcp.Connector{Dialer: dialer}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			_, err := conn.DialFunc(ctx, "tcp", "project:region:instance:5432")
+			Expect(err).To(MatchError(failure))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("Postgres", Ordered, func() {
+		var pool *pgxpool.Pool
+
+		BeforeAll(func() {
+			url := os.Getenv("PGX_DATABASE_URL")
+			if url == "" {
+				Skip("PGX_DATABASE_URL not set")
+			}
+
+			config, err := pgxpool.ParseConfig(url)
+			Expect(err).NotTo(HaveOccurred())
+
+			// map the instance to the local Postgres server
+			dialer := &pgxgcptest.Dialer{
+				Instances: map[string]string{
+					"project:region:instance": net.JoinHostPort(config.ConnConfig.Host, strconv.Itoa(int(config.ConnConfig.Port))),
+				},
+			}
+
+			connector := &pgxgcp.Connector{Dialer: dialer}
+			config.ConnConfig.Host = "project:region:instance"
+			config.ConnConfig.TLSConfig = nil
+			config.ConnConfig.Fallbacks = nil
+			config.BeforeConnect = connector.BeforeConnect
+
+			pool, err = pgxpool.NewWithConfig(ctx, config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterAll(func() {
+			if pool != nil {
+				pool.Close()
+			}
+		})
+
+		It("queries the database through the connector", func() {
+			var value int
+			Expect(pool.QueryRow(ctx, "SELECT 1").Scan(&value)).To(Succeed())
+			Expect(value).To(Equal(1))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("IAMAuthN", func() {
+		It("clears the password", func() {
+			connector := &pgxgcp.Connector{IAMAuthN: true}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			conn.User = "alice@example.com"
+			conn.Password = "secret"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Password).To(BeEmpty())
+			Expect(conn.User).To(Equal("alice@example.com"))
+		})
+
+		It("derives the user from the IAM principal", func() {
+			connector := &pgxgcp.Connector{
+				IAMAuthN:     true,
+				IAMPrincipal: "app@project.iam.gserviceaccount.com",
+			}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			conn.User = "postgres"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.User).To(Equal("app@project.iam"))
+		})
+
+		It("trims a service account user from the conn config", func() {
+			connector := &pgxgcp.Connector{IAMAuthN: true}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			conn.User = "app@project.iam.gserviceaccount.com"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.User).To(Equal("app@project.iam"))
+		})
+
+		It("keeps the password when disabled", func() {
+			connector := &pgxgcp.Connector{}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:instance"
+			conn.Password = "secret"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Password).To(Equal("secret"))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("IAMUser", func() {
+		It("trims the service account suffix", func() {
+			Expect(pgxgcp.IAMUser("app@project.iam.gserviceaccount.com")).To(Equal("app@project.iam"))
+		})
+
+		It("returns user emails unchanged", func() {
+			Expect(pgxgcp.IAMUser("alice@example.com")).To(Equal("alice@example.com"))
 		})
 	})
 
@@ -0,0 +1,199 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultFailoverThreshold is the number of consecutive dial failures after
+// which the next candidate is tried when Connector.FailoverThreshold is zero.
+const DefaultFailoverThreshold = 3
+
+// ErrInRecovery is returned when a failover candidate is reachable but still in
+// recovery, i.e. not a writable primary.
+var ErrInRecovery = errors.New("pgxgcp: instance is in recovery")
+
+// FailoverEvent describes a change of the active instance of a logical
+// database.
+type FailoverEvent struct {
+	// Host is the logical database host from Connector.Failover.
+	Host string
+	// From is the instance connection name that was active.
+	From string
+	// To is the instance connection name that became active.
+	To string
+	// Err is the error that caused the change.
+	Err error
+}
+
+// failover tracks the active candidate of a logical database.
+type failover struct {
+	mu         sync.Mutex
+	candidates []string
+	active     int
+	failures   int
+}
+
+// current returns the active candidate.
+func (f *failover) current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.candidates[f.active]
+}
+
+// succeed resets the failure count of the candidate if it is still active.
+func (f *failover) succeed(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.candidates[f.active] == name {
+		f.failures = 0
+	}
+}
+
+// fail records a failure of the candidate. Once the threshold is reached, the
+// next candidate becomes active and the previous and new names are returned.
+func (f *failover) fail(name string, threshold int) (from, to string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// another connection attempt has already moved on
+	if f.candidates[f.active] != name {
+		return "", "", false
+	}
+
+	f.failures++
+	if f.failures < threshold {
+		return "", "", false
+	}
+
+	f.failures = 0
+	f.active = (f.active + 1) % len(f.candidates)
+
+	return name, f.candidates[f.active], true
+}
+
+// failover returns the failover state of the logical database host, or nil
+// when the host is not listed in Failover.
+func (x *Connector) failover(host string) *failover {
+	candidates, ok := x.Failover[host]
+	if !ok || len(candidates) == 0 {
+		return nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.failovers == nil {
+		x.failovers = make(map[string]*failover)
+	}
+
+	state, ok := x.failovers[host]
+	if !ok {
+		state = &failover{candidates: candidates}
+		x.failovers[host] = state
+	}
+
+	return state
+}
+
+// failoverConnect prepares the conn config of a logical database host so that
+// it dials the active candidate, fails over to the next one and only accepts
+// a writable node.
+func (x *Connector) failoverConnect(conn *pgx.ConnConfig, state *failover) error {
+	for _, name := range state.candidates {
+		if !IsInstanceConnectionName(name) {
+			return fmt.Errorf("pgxgcp: invalid Cloud SQL instance connection name %q in failover of %q", name, conn.Host)
+		}
+	}
+
+	threshold := x.FailoverThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailoverThreshold
+	}
+
+	host := conn.Host
+	// fail records the failure and emits an event on a change
+	fail := func(name string, limit int, err error) {
+		from, to, ok := state.fail(name, limit)
+		if ok && x.OnFailover != nil {
+			x.OnFailover(FailoverEvent{Host: host, From: from, To: to, Err: err})
+		}
+	}
+
+	// the instance dialed by this connection attempt
+	var dialed string
+
+	conn.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+		var errs []error
+
+		for range state.candidates {
+			name := state.current()
+			// dial the active candidate
+			c, err := x.dial(ctx, name)
+			if err == nil {
+				dialed = name
+				return c, nil
+			}
+
+			errs = append(errs, err)
+			fail(name, threshold, err)
+			// try the next candidate only when the active one has changed
+			if state.current() == name || ctx.Err() != nil {
+				break
+			}
+		}
+
+		return nil, errors.Join(errs...)
+	}
+
+	validate := conn.ValidateConnect
+	conn.ValidateConnect = func(ctx context.Context, pgconn *pgconn.PgConn) error {
+		// the active instance must not be in recovery
+		switch err := validateWritable(ctx, pgconn); {
+		case errors.Is(err, ErrInRecovery):
+			// a node in recovery will not become writable by retrying it
+			fail(dialed, 1, err)
+			return err
+		case err != nil:
+			fail(dialed, threshold, err)
+			return err
+		}
+
+		state.succeed(dialed)
+
+		if validate != nil {
+			return validate(ctx, pgconn)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// validateWritable checks with pg_is_in_recovery() that the server is a
+// writable primary.
+func validateWritable(ctx context.Context, conn *pgconn.PgConn) error {
+	result, err := conn.Exec(ctx, "SELECT pg_is_in_recovery()").ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if len(result) == 0 || len(result[0].Rows) == 0 || len(result[0].Rows[0]) == 0 {
+		return errors.New("pgxgcp: pg_is_in_recovery() returned no rows")
+	}
+
+	if string(result[0].Rows[0][0]) == "t" {
+		return ErrInRecovery
+	}
+
+	return nil
+}
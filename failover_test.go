@@ -0,0 +1,191 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("Failover", func() {
+	var (
+		ctx       context.Context
+		connector *pgxgcp.Connector
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		connector = &pgxgcp.Connector{
+			Failover: map[string][]string{
+				"orders": {"project:us-central1:orders", "project:us-east1:orders-dr"},
+			},
+		}
+	})
+
+	It("prepares the conn config of a logical database", func() {
+		conn := &pgx.ConnConfig{}
+		conn.Host = "orders"
+
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.DialFunc).NotTo(BeNil())
+		Expect(conn.LookupFunc).NotTo(BeNil())
+		Expect(conn.ValidateConnect).NotTo(BeNil())
+	})
+
+	It("starts with the first candidate", func() {
+		Expect(connector.Active("orders")).To(Equal("project:us-central1:orders"))
+	})
+
+	It("returns other hosts unchanged", func() {
+		Expect(connector.Active("project:region:instance")).To(Equal("project:region:instance"))
+	})
+
+	Describe("DialFunc", func() {
+		var (
+			dialer *pgxgcptest.Dialer
+			events []pgxgcp.FailoverEvent
+		)
+
+		BeforeEach(func() {
+			events = nil
+			dialer = &pgxgcptest.Dialer{
+				Instances: map[string]string{
+					"project:us-central1:orders": listen(),
+					"project:us-east1:orders-dr": listen(),
+				},
+			}
+
+			connector.Dialer = dialer
+			connector.FailoverThreshold = 2
+			connector.OnFailover = func(event pgxgcp.FailoverEvent) {
+				events = append(events, event)
+			}
+		})
+
+		dial := func() (net.Conn, error) {
+			conn := &pgx.ConnConfig{}
+			conn.Host = "orders"
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			c, err := conn.DialFunc(ctx, "tcp", "")
+			if c != nil {
+				DeferCleanup(c.Close)
+			}
+			return c, err
+		}
+
+		It("dials the active candidate", func() {
+			_, err := dial()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dialer.Dials("project:us-central1:orders")).To(Equal(1))
+			Expect(dialer.Dials("project:us-east1:orders-dr")).To(BeZero())
+			Expect(events).To(BeEmpty())
+		})
+
+		It("fails over after the threshold", func() {
+			failure := errors.New("instance unavailable")
+			dialer.Fail("project:us-central1:orders", failure)
+
+			// the first failure stays below the threshold
+			_, err := dial()
+			Expect(err).To(MatchError(failure))
+			Expect(connector.Active("orders")).To(Equal("project:us-central1:orders"))
+
+			// the second failure switches to the next candidate and dials it
+			_, err = dial()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connector.Active("orders")).To(Equal("project:us-east1:orders-dr"))
+			Expect(dialer.Dials("project:us-east1:orders-dr")).To(Equal(1))
+
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Host).To(Equal("orders"))
+			Expect(events[0].From).To(Equal("project:us-central1:orders"))
+			Expect(events[0].To).To(Equal("project:us-east1:orders-dr"))
+			Expect(events[0].Err).To(MatchError(failure))
+		})
+	})
+
+	Describe("ValidateConnect", func() {
+		var (
+			dialer *pgxgcptest.Dialer
+			events []pgxgcp.FailoverEvent
+		)
+
+		BeforeEach(func() {
+			events = nil
+			dialer = &pgxgcptest.Dialer{
+				Instances: map[string]string{
+					"project:us-central1:orders": postgres("t"),
+					"project:us-east1:orders-dr": postgres("f"),
+				},
+			}
+
+			connector.Dialer = dialer
+			connector.OnFailover = func(event pgxgcp.FailoverEvent) {
+				events = append(events, event)
+			}
+		})
+
+		connect := func() (*pgx.Conn, error) {
+			config, err := pgx.ParseConfig("user=postgres sslmode=disable")
+			Expect(err).NotTo(HaveOccurred())
+			config.Host = "orders"
+			Expect(connector.BeforeConnect(ctx, config)).To(Succeed())
+
+			conn, err := pgx.ConnectConfig(ctx, config)
+			if conn != nil {
+				DeferCleanup(func() { _ = conn.Close(context.Background()) })
+			}
+			return conn, err
+		}
+
+		It("fails over from a candidate in recovery", func() {
+			_, err := connect()
+			Expect(err).To(MatchError(pgxgcp.ErrInRecovery))
+			Expect(connector.Active("orders")).To(Equal("project:us-east1:orders-dr"))
+
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].From).To(Equal("project:us-central1:orders"))
+			Expect(events[0].To).To(Equal("project:us-east1:orders-dr"))
+			Expect(events[0].Err).To(MatchError(pgxgcp.ErrInRecovery))
+
+			// the next connection is made to the writable candidate
+			_, err = connect()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connector.Active("orders")).To(Equal("project:us-east1:orders-dr"))
+			Expect(dialer.Dials("project:us-east1:orders-dr")).To(Equal(1))
+			Expect(events).To(HaveLen(1))
+		})
+
+		It("keeps a writable candidate active", func() {
+			dialer.Instances["project:us-central1:orders"] = postgres("f")
+
+			_, err := connect()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connector.Active("orders")).To(Equal("project:us-central1:orders"))
+			Expect(events).To(BeEmpty())
+		})
+
+		It("rejects an empty result", func() {
+			dialer.Instances["project:us-central1:orders"] = postgres()
+
+			_, err := connect()
+			Expect(err).To(MatchError(ContainSubstring("returned no rows")))
+			Expect(connector.Active("orders")).To(Equal("project:us-central1:orders"))
+		})
+	})
+
+	It("rejects a malformed candidate", func() {
+		connector.Failover["orders"] = append(connector.Failover["orders"], "orders-dr")
+
+		conn := &pgx.ConnConfig{}
+		conn.Host = "orders"
+
+		Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("in failover of \"orders\"")))
+	})
+})
@@ -0,0 +1,86 @@
+package pgxgcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"cloud.google.com/go/cloudsqlconn"
+)
+
+// IPType selects the IP address of a Cloud SQL instance that is dialed.
+type IPType string
+
+const (
+	// IPTypePublic dials the public IP address of the instance.
+	IPTypePublic IPType = "public"
+	// IPTypePrivate dials the private IP address of the instance.
+	IPTypePrivate IPType = "private"
+	// IPTypePSC dials the Private Service Connect endpoint of the instance.
+	IPTypePSC IPType = "psc"
+)
+
+// ParseIPType parses an IP type, such as the ip_type parameter of a cloudsql://
+// URL. The value is case-insensitive.
+func ParseIPType(value string) (IPType, error) {
+	switch kind := IPType(strings.ToLower(value)); kind {
+	case IPTypePublic, IPTypePrivate, IPTypePSC:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("pgxgcp: unknown ip type %q", value)
+	}
+}
+
+// option returns the dial option of the IP type.
+func (t IPType) option() (cloudsqlconn.DialOption, error) {
+	switch t {
+	case IPTypePublic:
+		return cloudsqlconn.WithPublicIP(), nil
+	case IPTypePrivate:
+		return cloudsqlconn.WithPrivateIP(), nil
+	case IPTypePSC:
+		return cloudsqlconn.WithPSC(), nil
+	default:
+		return nil, fmt.Errorf("pgxgcp: unknown ip type %q", string(t))
+	}
+}
+
+// InstanceConfig holds the dial settings of a single Cloud SQL instance.
+type InstanceConfig struct {
+	// IPType selects the IP address that is dialed. The default of the dialer
+	// is used when empty.
+	IPType IPType
+	// PSCHost overrides the host dialed for a Private Service Connect endpoint,
+	// e.g. a DNS name in a private zone that points at the endpoint. The port
+	// chosen by the dialer is kept. It requires the IPTypePSC ip type, set
+	// here or on the Connector, and the dial fails otherwise.
+	PSCHost string
+}
+
+// options returns the dial options of the instance configuration.
+func (c InstanceConfig) options() ([]cloudsqlconn.DialOption, error) {
+	var options []cloudsqlconn.DialOption
+
+	if c.IPType != "" {
+		option, err := c.IPType.option()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	if c.PSCHost != "" {
+		dialer := &net.Dialer{}
+		// replace the endpoint address with the override
+		options = append(options, cloudsqlconn.WithOneOffDialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(c.PSCHost, port))
+		}))
+	}
+
+	return options, nil
+}
@@ -0,0 +1,81 @@
+package pgxgcp_test
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("ParseIPType", func() {
+	DescribeTable("parses known IP types",
+		func(value string, expected pgxgcp.IPType) {
+			kind, err := pgxgcp.ParseIPType(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kind).To(Equal(expected))
+		},
+		Entry("public", "public", pgxgcp.IPTypePublic),
+		Entry("private", "PRIVATE", pgxgcp.IPTypePrivate),
+		Entry("psc", "psc", pgxgcp.IPTypePSC),
+	)
+
+	It("rejects an unknown IP type", func() {
+		_, err := pgxgcp.ParseIPType("ipv6")
+		Expect(err).To(MatchError(ContainSubstring("unknown ip type")))
+	})
+})
+
+var _ = Describe("InstanceConfig", func() {
+	var (
+		ctx       context.Context
+		connector *pgxgcp.Connector
+	)
+
+	// dial opens a connection to the instance through the connector.
+	dial := func() error {
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:billing"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		connector = &pgxgcp.Connector{
+			Dialer: &pgxgcptest.Dialer{
+				Instances: map[string]string{"project:region:billing": listen()},
+			},
+		}
+	})
+
+	DescribeTable("dials with a PSCHost",
+		func(config pgxgcp.InstanceConfig, kind pgxgcp.IPType) {
+			connector.Instances = map[string]pgxgcp.InstanceConfig{"project:region:billing": config}
+			connector.IPType = kind
+
+			Expect(dial()).To(Succeed())
+		},
+		Entry("psc instance", pgxgcp.InstanceConfig{IPType: pgxgcp.IPTypePSC, PSCHost: "billing.db.internal"}, pgxgcp.IPType("")),
+		Entry("psc connector", pgxgcp.InstanceConfig{PSCHost: "billing.db.internal"}, pgxgcp.IPTypePSC),
+	)
+
+	DescribeTable("rejects a PSCHost for other ip types",
+		func(config pgxgcp.InstanceConfig, kind pgxgcp.IPType) {
+			connector.Instances = map[string]pgxgcp.InstanceConfig{"project:region:billing": config}
+			connector.IPType = kind
+
+			Expect(dial()).To(MatchError(ContainSubstring("has a PSCHost")))
+		},
+		Entry("public", pgxgcp.InstanceConfig{IPType: pgxgcp.IPTypePublic, PSCHost: "billing.db.internal"}, pgxgcp.IPType("")),
+		Entry("private connector", pgxgcp.InstanceConfig{PSCHost: "billing.db.internal"}, pgxgcp.IPTypePrivate),
+		Entry("dialer default", pgxgcp.InstanceConfig{PSCHost: "billing.db.internal"}, pgxgcp.IPType("")),
+	)
+})
@@ -0,0 +1,228 @@
+package pgxgcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/tracelog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultSlowQueryThreshold is the duration from which a query is logged as
+// slow when QueryLogger.SlowThreshold is zero.
+const DefaultSlowQueryThreshold = time.Second
+
+// Redacted replaces the query arguments redacted by RedactArgs.
+const Redacted = "[REDACTED]"
+
+// Cloud Logging severities.
+const (
+	severityDebug   = "DEBUG"
+	severityInfo    = "INFO"
+	severityWarning = "WARNING"
+	severityError   = "ERROR"
+)
+
+// RedactArgs replaces every query argument with Redacted. It is the default
+// QueryLogger.Redact.
+func RedactArgs(args []any) []any {
+	redacted := make([]any, len(args))
+	for index := range redacted {
+		redacted[index] = Redacted
+	}
+
+	return redacted
+}
+
+var (
+	_ pgx.QueryTracer = &QueryLogger{}
+	_ tracelog.Logger = &QueryLogger{}
+)
+
+// QueryLogger writes slow and failed queries as Cloud Logging structured JSON
+// lines, one per query, with the trace and span of the OpenTelemetry span in
+// the context, so they correlate with the request logs. It is a pgx.QueryTracer,
+// and a tracelog.Logger for the other events of tracelog.TraceLog.
+type QueryLogger struct {
+	// Writer receives the log entries. Defaults to os.Stdout, which Cloud Run
+	// and GKE forward to Cloud Logging.
+	Writer io.Writer
+	// ProjectID is the project of the traces. Defaults to GOOGLE_CLOUD_PROJECT;
+	// without a project the trace is not linked.
+	ProjectID string
+	// SlowThreshold is the duration from which a successful query is logged with
+	// severity WARNING. Defaults to DefaultSlowQueryThreshold; a negative value
+	// logs every query, faster ones with severity DEBUG.
+	SlowThreshold time.Duration
+	// Redact returns the query arguments that are logged. Defaults to
+	// RedactArgs.
+	Redact func(args []any) []any
+
+	mu sync.Mutex
+}
+
+// queryLogKey is the context key of the query in flight.
+type queryLogKey struct{}
+
+// queryLog is the query in flight.
+type queryLog struct {
+	start time.Time
+	sql   string
+	args  []any
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (x *QueryLogger) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	query := &queryLog{start: time.Now(), sql: data.SQL, args: data.Args}
+	return context.WithValue(ctx, queryLogKey{}, query)
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (x *QueryLogger) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	query, ok := ctx.Value(queryLogKey{}).(*queryLog)
+	if !ok {
+		return
+	}
+
+	elapsed := time.Since(query.start)
+
+	threshold := x.SlowThreshold
+	if threshold == 0 {
+		threshold = DefaultSlowQueryThreshold
+	}
+
+	entry := map[string]any{
+		"sql":      query.sql,
+		"args":     x.redact(query.args),
+		"duration": elapsed.String(),
+	}
+
+	switch {
+	case data.Err != nil:
+		entry["severity"] = severityError
+		entry["message"] = "query failed"
+		entry["error"] = data.Err.Error()
+
+		var pgErr *pgconn.PgError
+		if errors.As(data.Err, &pgErr) {
+			entry["sqlstate"] = pgErr.Code
+		}
+	case threshold > 0 && elapsed >= threshold:
+		entry["severity"] = severityWarning
+		entry["message"] = "slow query"
+		entry["commandTag"] = data.CommandTag.String()
+	case threshold < 0:
+		entry["severity"] = severityDebug
+		entry["message"] = "query"
+		entry["commandTag"] = data.CommandTag.String()
+	default:
+		return
+	}
+
+	instance := ""
+	// the config is copied, so it is only looked up for an entry that is written
+	if conn != nil {
+		instance = conn.Config().Host
+	}
+
+	x.write(ctx, instance, entry)
+}
+
+// Log implements tracelog.Logger.
+func (x *QueryLogger) Log(ctx context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+	entry := make(map[string]any, len(data)+2)
+	for key, value := range data {
+		switch value := value.(type) {
+		case error:
+			entry[key] = value.Error()
+		case time.Duration:
+			entry[key] = value.String()
+		case fmt.Stringer:
+			entry[key] = value.String()
+		default:
+			entry[key] = value
+		}
+	}
+
+	if args, ok := data["args"].([]any); ok {
+		entry["args"] = x.redact(args)
+	}
+
+	entry["severity"] = severity(level)
+	entry["message"] = msg
+
+	instance, _ := data["host"].(string)
+	x.write(ctx, instance, entry)
+}
+
+// redact returns the arguments that are logged.
+func (x *QueryLogger) redact(args []any) []any {
+	if x.Redact != nil {
+		return x.Redact(args)
+	}
+
+	return RedactArgs(args)
+}
+
+// write adds the common fields to the entry and writes it as a JSON line.
+func (x *QueryLogger) write(ctx context.Context, instance string, entry map[string]any) {
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+
+	if instance != "" {
+		entry["logging.googleapis.com/labels"] = map[string]string{string(InstanceKey): instance}
+	}
+
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		project := x.ProjectID
+		if project == "" {
+			project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+
+		if project != "" {
+			entry["logging.googleapis.com/trace"] = "projects/" + project + "/traces/" + span.TraceID().String()
+		}
+		entry["logging.googleapis.com/spanId"] = span.SpanID().String()
+		entry["logging.googleapis.com/trace_sampled"] = span.IsSampled()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// an argument that cannot be encoded must not lose the entry
+		delete(entry, "args")
+		if data, err = json.Marshal(entry); err != nil {
+			return
+		}
+	}
+
+	writer := x.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	_, _ = writer.Write(append(data, '\n'))
+}
+
+// severity maps a pgx log level to a Cloud Logging severity.
+func severity(level tracelog.LogLevel) string {
+	switch level {
+	case tracelog.LogLevelError:
+		return severityError
+	case tracelog.LogLevelWarn:
+		return severityWarning
+	case tracelog.LogLevelInfo:
+		return severityInfo
+	default:
+		return severityDebug
+	}
+}
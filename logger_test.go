@@ -0,0 +1,159 @@
+package pgxgcp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/tracelog"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("QueryLogger", func() {
+	var (
+		ctx    context.Context
+		buffer *bytes.Buffer
+		logger *pgxgcp.QueryLogger
+	)
+
+	// query traces a query with the given outcome and returns the entries.
+	query := func(err error) []map[string]any {
+		ctx := logger.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+			SQL:  "SELECT * FROM users WHERE email = $1",
+			Args: []any{"jane@example.com"},
+		})
+		logger.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{
+			CommandTag: pgconn.NewCommandTag("SELECT 1"),
+			Err:        err,
+		})
+
+		var entries []map[string]any
+		decoder := json.NewDecoder(buffer)
+		for decoder.More() {
+			entry := map[string]any{}
+			Expect(decoder.Decode(&entry)).To(Succeed())
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		buffer = &bytes.Buffer{}
+		logger = &pgxgcp.QueryLogger{Writer: buffer, ProjectID: "project"}
+	})
+
+	It("skips fast queries", func() {
+		Expect(query(nil)).To(BeEmpty())
+	})
+
+	It("logs slow queries as warnings", func() {
+		logger.SlowThreshold = 1
+
+		entries := query(nil)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0]).To(HaveKeyWithValue("severity", "WARNING"))
+		Expect(entries[0]).To(HaveKeyWithValue("message", "slow query"))
+		Expect(entries[0]).To(HaveKeyWithValue("sql", "SELECT * FROM users WHERE email = $1"))
+		Expect(entries[0]).To(HaveKeyWithValue("commandTag", "SELECT 1"))
+		Expect(entries[0]).To(HaveKey("duration"))
+		Expect(entries[0]).To(HaveKey("time"))
+	})
+
+	It("logs every query with a negative threshold", func() {
+		logger.SlowThreshold = -1
+
+		entries := query(nil)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0]).To(HaveKeyWithValue("severity", "DEBUG"))
+	})
+
+	It("logs failed queries as errors", func() {
+		entries := query(&pgconn.PgError{Code: "23505", Message: "duplicate key"})
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0]).To(HaveKeyWithValue("severity", "ERROR"))
+		Expect(entries[0]).To(HaveKeyWithValue("sqlstate", "23505"))
+		Expect(entries[0]).To(HaveKeyWithValue("error", ContainSubstring("duplicate key")))
+	})
+
+	It("redacts the arguments", func() {
+		entries := query(errors.New("boom"))
+		Expect(entries[0]).To(HaveKeyWithValue("args", []any{pgxgcp.Redacted}))
+	})
+
+	It("logs the arguments returned by Redact", func() {
+		logger.Redact = func(args []any) []any { return args }
+
+		entries := query(errors.New("boom"))
+		Expect(entries[0]).To(HaveKeyWithValue("args", []any{"jane@example.com"}))
+	})
+
+	It("links the trace and span", func() {
+		ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+			SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+			TraceFlags: trace.FlagsSampled,
+		}))
+
+		entries := query(errors.New("boom"))
+		Expect(entries[0]).To(HaveKeyWithValue("logging.googleapis.com/trace", "projects/project/traces/4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(entries[0]).To(HaveKeyWithValue("logging.googleapis.com/spanId", "00f067aa0ba902b7"))
+		Expect(entries[0]).To(HaveKeyWithValue("logging.googleapis.com/trace_sampled", true))
+	})
+
+	It("labels the entry with the instance of the connection", func() {
+		connector := &pgxgcp.Connector{
+			Dialer: &pgxgcptest.Dialer{
+				Instances: map[string]string{"project:region:instance": postgres()},
+			},
+		}
+
+		config, err := pgx.ParseConfig("user=postgres sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+		config.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, config)).To(Succeed())
+
+		conn, err := pgx.ConnectConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { _ = conn.Close(context.Background()) })
+
+		traced := logger.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+		logger.TraceQueryEnd(traced, conn, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+		entry := map[string]any{}
+		Expect(json.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+		Expect(entry).To(HaveKeyWithValue("logging.googleapis.com/labels", HaveKeyWithValue("cloudsql.instance", "project:region:instance")))
+	})
+
+	DescribeTable("maps tracelog levels to severities",
+		func(level tracelog.LogLevel, severity string) {
+			logger.Log(ctx, level, "Connect", map[string]any{"host": "project:region:instance", "err": errors.New("boom")})
+
+			entry := map[string]any{}
+			Expect(json.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry).To(HaveKeyWithValue("severity", severity))
+			Expect(entry).To(HaveKeyWithValue("message", "Connect"))
+			Expect(entry).To(HaveKeyWithValue("err", "boom"))
+			Expect(entry).To(HaveKeyWithValue("logging.googleapis.com/labels", HaveKeyWithValue("cloudsql.instance", "project:region:instance")))
+		},
+		Entry("error", tracelog.LogLevelError, "ERROR"),
+		Entry("warn", tracelog.LogLevelWarn, "WARNING"),
+		Entry("info", tracelog.LogLevelInfo, "INFO"),
+		Entry("debug", tracelog.LogLevelDebug, "DEBUG"),
+	)
+
+	It("redacts the arguments logged by tracelog", func() {
+		logger.Log(ctx, tracelog.LogLevelInfo, "Query", map[string]any{"args": []any{"secret"}})
+
+		entry := map[string]any{}
+		Expect(json.Unmarshal(buffer.Bytes(), &entry)).To(Succeed())
+		Expect(entry).To(HaveKeyWithValue("args", []any{pgxgcp.Redacted}))
+	})
+})
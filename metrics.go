@@ -0,0 +1,200 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtype"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ScopeName is the instrumentation scope name of the OpenTelemetry meter and
+// tracer used by pgxgcp.
+const ScopeName = "github.com/pgx-contrib/pgxgcp"
+
+const (
+	// InstanceKey is the attribute key of the Cloud SQL instance connection name.
+	InstanceKey = attribute.Key("cloudsql.instance")
+	// ErrorClassKey is the attribute key of the class of a dial error, see
+	// ErrorClass.
+	ErrorClassKey = attribute.Key("error.class")
+	// ResultKey is the attribute key of the result of a certificate refresh,
+	// either "success" or "error".
+	ResultKey = attribute.Key("result")
+)
+
+// ErrorClass returns the class of a dial error:
+//
+//   - config: the request is invalid, e.g. an unknown instance or IP type
+//   - refresh: the instance metadata or certificate could not be fetched
+//   - dial: the connection could not be established
+//   - timeout: the dial did not complete in time
+//   - canceled: the context was canceled
+//   - other: any other error
+func ErrorClass(err error) string {
+	var (
+		configErr  *errtype.ConfigError
+		refreshErr *errtype.RefreshError
+		dialErr    *errtype.DialError
+		netErr     net.Error
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &configErr):
+		return "config"
+	case errors.As(err, &refreshErr):
+		return "refresh"
+	case errors.As(err, &dialErr):
+		return "dial"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "other"
+	}
+}
+
+// connectorMetrics holds the instruments of a Connector.
+type connectorMetrics struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+	open     metric.Int64UpDownCounter
+}
+
+// refreshViews maps the OpenCensus views of the certificate refreshes of
+// cloudsqlconn to their result.
+var refreshViews = map[string]string{
+	"cloudsqlconn/refresh_success_count": "success",
+	"cloudsqlconn/refresh_failure_count": "error",
+}
+
+// metrics returns the instruments of the connector, creating them on first
+// use.
+func (x *Connector) metrics() *connectorMetrics {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.meter == nil {
+		provider := x.MeterProvider
+		if provider == nil {
+			provider = otel.GetMeterProvider()
+		}
+
+		x.meter = newConnectorMetrics(provider.Meter(ScopeName))
+	}
+
+	return x.meter
+}
+
+// newConnectorMetrics creates the instruments. Instrument errors are handed
+// to the global OpenTelemetry error handler and a no-op instrument is used.
+func newConnectorMetrics(meter metric.Meter) *connectorMetrics {
+	duration, err := meter.Float64Histogram("pgxgcp.dial.duration",
+		metric.WithDescription("Duration of Cloud SQL dials."),
+		metric.WithUnit("s"),
+	)
+	handle(err)
+
+	failures, err := meter.Int64Counter("pgxgcp.dial.errors",
+		metric.WithDescription("Number of failed Cloud SQL dials by error class."),
+		metric.WithUnit("{error}"),
+	)
+	handle(err)
+
+	open, err := meter.Int64UpDownCounter("pgxgcp.connections.open",
+		metric.WithDescription("Number of open connections dialed through the connector."),
+		metric.WithUnit("{connection}"),
+	)
+	handle(err)
+
+	refreshes, err := meter.Int64ObservableCounter("pgxgcp.certificate.refreshes",
+		metric.WithDescription("Number of certificate refreshes of the Cloud SQL dialers of the process, as recorded by cloudsqlconn."),
+		metric.WithUnit("{refresh}"),
+	)
+	handle(err)
+
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		observeRefreshes(observer, refreshes)
+		return nil
+	}, refreshes)
+	handle(err)
+
+	return &connectorMetrics{
+		duration: duration,
+		errors:   failures,
+		open:     open,
+	}
+}
+
+// observeRefreshes observes the refresh counts of the OpenCensus views of
+// cloudsqlconn, which include the background and lazy refreshes of every
+// dialer. The views are registered by cloudsqlconn.NewDialer, until then
+// nothing is observed.
+func observeRefreshes(observer metric.Observer, refreshes metric.Int64Observable) {
+	for name, result := range refreshViews {
+		rows, err := view.RetrieveData(name)
+		if err != nil {
+			continue
+		}
+
+		// sum the rows of the dialers and error codes of each instance
+		counts := make(map[string]int64)
+		for _, row := range rows {
+			data, ok := row.Data.(*view.CountData)
+			if !ok {
+				continue
+			}
+
+			for _, t := range row.Tags {
+				if t.Key.Name() == "cloudsql_instance" {
+					counts[t.Value] += data.Value
+				}
+			}
+		}
+
+		for instance, count := range counts {
+			observer.ObserveInt64(refreshes, count, metric.WithAttributes(InstanceKey.String(instance), ResultKey.String(result)))
+		}
+	}
+}
+
+// handle reports an instrument error to the global OpenTelemetry error
+// handler.
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// dialed records the duration and outcome of a dial.
+func (m *connectorMetrics) dialed(ctx context.Context, instance string, elapsed time.Duration, err error) {
+	attributes := metric.WithAttributes(InstanceKey.String(instance))
+	m.duration.Record(ctx, elapsed.Seconds(), attributes)
+
+	if err != nil {
+		m.errors.Add(ctx, 1, metric.WithAttributes(InstanceKey.String(instance), ErrorClassKey.String(ErrorClass(err))))
+	}
+}
+
+// track counts the connection as open until it is closed.
+func (m *connectorMetrics) track(ctx context.Context, instance string, conn net.Conn) net.Conn {
+	attributes := metric.WithAttributes(InstanceKey.String(instance))
+	m.open.Add(ctx, 1, attributes)
+
+	return &trackedConn{
+		Conn: conn,
+		done: func() {
+			// the dial context may be gone by the time the connection is closed
+			m.open.Add(context.Background(), -1, attributes)
+		},
+	}
+}
@@ -0,0 +1,173 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"cloud.google.com/go/cloudsqlconn/errtype"
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("ErrorClass", func() {
+	DescribeTable("classifies dial errors",
+		func(err error, class string) {
+			Expect(pgxgcp.ErrorClass(err)).To(Equal(class))
+		},
+		Entry("config", errtype.NewConfigError("bad name", "p:r:i"), "config"),
+		Entry("refresh", errtype.NewRefreshError("no cert", "p:r:i", nil), "refresh"),
+		Entry("dial", errtype.NewDialError("handshake", "p:r:i", nil), "dial"),
+		Entry("deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), "timeout"),
+		Entry("io deadline", os.ErrDeadlineExceeded, "timeout"),
+		Entry("canceled", context.Canceled, "canceled"),
+		Entry("other", errors.New("boom"), "other"),
+	)
+})
+
+var _ = Describe("Metrics", func() {
+	var (
+		ctx       context.Context
+		reader    *sdkmetric.ManualReader
+		dialer    *pgxgcptest.Dialer
+		connector *pgxgcp.Connector
+	)
+
+	// collect returns the metrics recorded so far by name.
+	collect := func() map[string]metricdata.Aggregation {
+		data := metricdata.ResourceMetrics{}
+		Expect(reader.Collect(ctx, &data)).To(Succeed())
+
+		metrics := make(map[string]metricdata.Aggregation)
+		for _, scope := range data.ScopeMetrics {
+			for _, item := range scope.Metrics {
+				metrics[item.Name] = item.Data
+			}
+		}
+		return metrics
+	}
+
+	// sum returns the value of the int64 sum data point with the attributes.
+	sum := func(data metricdata.Aggregation, attrs ...attribute.KeyValue) int64 {
+		set := attribute.NewSet(attrs...)
+		for _, point := range data.(metricdata.Sum[int64]).DataPoints {
+			if point.Attributes.Equals(&set) {
+				return point.Value
+			}
+		}
+		return 0
+	}
+
+	dial := func() (func() error, error) {
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		if err != nil {
+			return nil, err
+		}
+		return c.Close, nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reader = sdkmetric.NewManualReader()
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{"project:region:instance": listen()},
+		}
+		connector = &pgxgcp.Connector{
+			Dialer:        dialer,
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		}
+	})
+
+	It("records the dial duration", func() {
+		closer, err := dial()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(closer)
+
+		data := collect()["pgxgcp.dial.duration"].(metricdata.Histogram[float64])
+		Expect(data.DataPoints).To(HaveLen(1))
+		Expect(data.DataPoints[0].Count).To(BeEquivalentTo(1))
+
+		value, ok := data.DataPoints[0].Attributes.Value(pgxgcp.InstanceKey)
+		Expect(ok).To(BeTrue())
+		Expect(value.AsString()).To(Equal("project:region:instance"))
+	})
+
+	It("counts dial errors by class", func() {
+		dialer.Fail("project:region:instance", errtype.NewRefreshError("no cert", "project:region:instance", nil))
+
+		_, err := dial()
+		Expect(err).To(HaveOccurred())
+
+		metrics := collect()
+		Expect(sum(metrics["pgxgcp.dial.errors"],
+			pgxgcp.InstanceKey.String("project:region:instance"),
+			pgxgcp.ErrorClassKey.String("refresh"),
+		)).To(BeEquivalentTo(1))
+	})
+
+	It("tracks open connections", func() {
+		first, err := dial()
+		Expect(err).NotTo(HaveOccurred())
+		second, err := dial()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(second)
+
+		instance := pgxgcp.InstanceKey.String("project:region:instance")
+		Expect(sum(collect()["pgxgcp.connections.open"], instance)).To(BeEquivalentTo(2))
+
+		Expect(first()).To(Succeed())
+		Expect(sum(collect()["pgxgcp.connections.open"], instance)).To(BeEquivalentTo(1))
+	})
+
+	It("reports the certificate refreshes of the dialer", func() {
+		// an admin API that rejects every request fails the refresh
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, `{"error": {"code": 403, "message": "denied"}}`, http.StatusForbidden)
+		}))
+		DeferCleanup(server.Close)
+
+		cloudsql, err := cloudsqlconn.NewDialer(ctx,
+			cloudsqlconn.WithAdminAPIEndpoint(server.URL),
+			cloudsqlconn.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})),
+			cloudsqlconn.WithLazyRefresh(),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cloudsql.Close)
+
+		// the views of cloudsqlconn are shared by the process
+		connector.Dialer = cloudsql
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:refreshes"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		_, err = conn.DialFunc(ctx, "tcp", "")
+		Expect(err).To(HaveOccurred())
+
+		// cloudsqlconn records the result in the background
+		Eventually(func() int64 {
+			data, ok := collect()["pgxgcp.certificate.refreshes"]
+			if !ok {
+				return 0
+			}
+			return sum(data,
+				pgxgcp.InstanceKey.String("project:region:refreshes"),
+				pgxgcp.ResultKey.String("error"),
+			)
+		}).Should(BeNumerically(">=", 1))
+	})
+})
@@ -0,0 +1,124 @@
+package pgxgcp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// InstanceOverridesEnv is the environment variable read by Connect and
+// ParseConfig to populate Connector.Overrides, e.g.
+//
+//	PGXGCP_INSTANCE_OVERRIDES=project:region:orders=localhost:5432,project:region:billing=/var/run/postgresql
+const InstanceOverridesEnv = "PGXGCP_INSTANCE_OVERRIDES"
+
+// ParseInstanceOverrides parses a comma separated list of
+// instance=address pairs in the format of InstanceOverridesEnv.
+func ParseInstanceOverrides(value string) (map[string]string, error) {
+	overrides := make(map[string]string)
+
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		// instance names contain colons, addresses do not contain "="
+		name, address, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || address == "" {
+			return nil, fmt.Errorf("pgxgcp: invalid instance override %q, expected INSTANCE=ADDRESS", entry)
+		}
+
+		if !IsInstanceConnectionName(name) {
+			return nil, fmt.Errorf("pgxgcp: invalid instance override %q: %q is not a Cloud SQL instance connection name", entry, name)
+		}
+
+		overrides[name] = address
+	}
+
+	return overrides, nil
+}
+
+// overridesFromEnv returns the overrides configured in InstanceOverridesEnv.
+func overridesFromEnv() (map[string]string, error) {
+	value := os.Getenv(InstanceOverridesEnv)
+	if value == "" {
+		return nil, nil
+	}
+
+	overrides, err := ParseInstanceOverrides(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", InstanceOverridesEnv, err)
+	}
+
+	return overrides, nil
+}
+
+// override points the conn config at the local address of an overridden
+// instance so that pgx dials it directly. It reports whether the host was
+// overridden.
+func (x *Connector) override(conn *pgx.ConnConfig) (bool, error) {
+	instance := conn.Host
+
+	address, ok := x.Overrides[instance]
+	if !ok {
+		return false, nil
+	}
+
+	// a unix socket directory or a host without a port keeps the configured port
+	host, port := address, uint16(0)
+	if !strings.HasPrefix(address, "/") {
+		if name, value, err := net.SplitHostPort(address); err == nil {
+			number, err := strconv.ParseUint(value, 10, 16)
+			if err != nil {
+				return false, fmt.Errorf("pgxgcp: invalid port in instance override %q: %w", address, err)
+			}
+			host, port = name, uint16(number)
+		}
+	}
+
+	conn.Host = host
+	if port != 0 {
+		conn.Port = port
+	}
+
+	// pgx dials the fallbacks, such as the plaintext attempt of sslmode=prefer,
+	// with their own host and port
+	for i, fallback := range conn.Fallbacks {
+		if fallback.Host != instance {
+			continue
+		}
+
+		// the fallbacks may be shared with the parsed config
+		fallback = &pgconn.FallbackConfig{Host: host, Port: fallback.Port, TLSConfig: fallback.TLSConfig}
+		if port != 0 {
+			fallback.Port = port
+		}
+		conn.Fallbacks[i] = fallback
+	}
+
+	return true, nil
+}
+
+// dialOverride dials the local address of an overridden instance.
+func dialOverride(ctx context.Context, address string) (net.Conn, error) {
+	network := "tcp"
+
+	switch _, _, err := net.SplitHostPort(address); {
+	case strings.HasPrefix(address, "/"):
+		// the socket file inside the directory, for the default port
+		network, address = "unix", address+"/.s.PGSQL.5432"
+	case err != nil:
+		// a host without a port
+		address = net.JoinHostPort(address, "5432")
+	}
+
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, network, address)
+}
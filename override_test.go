@@ -0,0 +1,165 @@
+package pgxgcp_test
+
+import (
+	"context"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"golang.org/x/oauth2"
+)
+
+var _ = Describe("Overrides", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("ParseInstanceOverrides", func() {
+		It("parses instance=address pairs", func() {
+			overrides, err := pgxgcp.ParseInstanceOverrides("project:region:orders=localhost:5432, project:region:billing=/var/run/postgresql")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(overrides).To(Equal(map[string]string{
+				"project:region:orders":  "localhost:5432",
+				"project:region:billing": "/var/run/postgresql",
+			}))
+		})
+
+		It("ignores empty entries", func() {
+			overrides, err := pgxgcp.ParseInstanceOverrides(",")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(overrides).To(BeEmpty())
+		})
+
+		DescribeTable("rejects malformed entries",
+			func(value string) {
+				_, err := pgxgcp.ParseInstanceOverrides(value)
+				Expect(err).To(MatchError(ContainSubstring("invalid instance override")))
+			},
+			Entry("missing address", "project:region:orders"),
+			Entry("empty address", "project:region:orders="),
+			Entry("not an instance", "orders=localhost:5432"),
+		)
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("BeforeConnect", func() {
+		It("points the config at the local address", func() {
+			connector := &pgxgcp.Connector{
+				IAMAuthN: true,
+				Overrides: map[string]string{
+					"project:region:orders": "localhost:6543",
+				},
+			}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:orders"
+			conn.Port = 5432
+			conn.Password = "secret"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Host).To(Equal("localhost"))
+			Expect(conn.Port).To(BeEquivalentTo(6543))
+			Expect(conn.Password).To(Equal("secret"))
+			Expect(conn.DialFunc).To(BeNil())
+		})
+
+		It("points the config at a unix socket directory", func() {
+			connector := &pgxgcp.Connector{
+				Overrides: map[string]string{
+					"project:region:orders": "/var/run/postgresql",
+				},
+			}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:orders"
+			conn.Port = 5432
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Host).To(Equal("/var/run/postgresql"))
+			Expect(conn.Port).To(BeEquivalentTo(5432))
+		})
+
+		It("connects to the local address with a parsed config", func() {
+			connector := &pgxgcp.Connector{
+				Overrides: map[string]string{
+					"project:region:orders": postgres(),
+				},
+			}
+
+			config, err := pgx.ParseConfig("host=project:region:orders user=postgres sslmode=prefer")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(connector.BeforeConnect(ctx, config)).To(Succeed())
+
+			// the server declines TLS, so the plaintext fallback is dialed
+			conn, err := pgx.ConnectConfig(ctx, config)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() { _ = conn.Close(context.Background()) })
+		})
+
+		It("rejects an invalid port", func() {
+			connector := &pgxgcp.Connector{
+				Overrides: map[string]string{
+					"project:region:orders": "localhost:http",
+				},
+			}
+
+			conn := &pgx.ConnConfig{}
+			conn.Host = "project:region:orders"
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid port")))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("DialFunc", func() {
+		It("dials overridden replicas at their local address", func() {
+			address := listen()
+
+			connector := &pgxgcp.ReplicaConnector{
+				Connector: &pgxgcp.Connector{
+					Overrides: map[string]string{
+						"project:region:replica": address,
+					},
+				},
+				Primary:  "project:region:primary",
+				Replicas: []string{"project:region:replica"},
+			}
+
+			conn := &pgx.ConnConfig{}
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			c, err := conn.DialFunc(ctx, "tcp", "")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(c.Close)
+
+			Expect(c.RemoteAddr().String()).To(Equal(address))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("InstanceOverridesEnv", func() {
+		It("is read by ParseConfig", func() {
+			GinkgoT().Setenv(pgxgcp.InstanceOverridesEnv, "project:region:orders=localhost:5432")
+
+			_, connector, err := pgxgcp.ParseConfig(ctx, "cloudsql://project:region:orders/app",
+				cloudsqlconn.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(connector.Close)
+
+			Expect(connector.Overrides).To(HaveKeyWithValue("project:region:orders", "localhost:5432"))
+		})
+
+		It("fails ParseConfig when malformed", func() {
+			GinkgoT().Setenv(pgxgcp.InstanceOverridesEnv, "orders")
+
+			_, _, err := pgxgcp.ParseConfig(ctx, "cloudsql://project:region:orders/app")
+			Expect(err).To(MatchError(ContainSubstring(pgxgcp.InstanceOverridesEnv)))
+		})
+	})
+})
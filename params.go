@@ -0,0 +1,199 @@
+package pgxgcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultApplicationNameTemplate is the application_name template used when
+// RuntimeParams.Template is empty. It yields service/revision on Cloud Run,
+// namespace/pod on GKE and the instance name on Compute Engine.
+const DefaultApplicationNameTemplate = `{{if .Service}}{{.Service}}{{with .Revision}}/{{.}}{{end}}{{else if .Pod}}{{with .Namespace}}{{.}}/{{end}}{{.Pod}}{{else}}{{.Instance}}{{end}}`
+
+// maxApplicationNameLength is the length Postgres truncates application_name
+// to.
+const maxApplicationNameLength = 63
+
+// kubernetesNamespaceFile holds the namespace of a Kubernetes pod.
+const kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Platform is the Google Cloud runtime environment of the process.
+type Platform string
+
+const (
+	// PlatformCloudRun is a Cloud Run service.
+	PlatformCloudRun Platform = "cloudrun"
+	// PlatformGKE is a Google Kubernetes Engine pod.
+	PlatformGKE Platform = "gke"
+	// PlatformGCE is a Compute Engine instance.
+	PlatformGCE Platform = "gce"
+)
+
+// Environment describes the runtime environment of the process. It is the data
+// of the RuntimeParams templates.
+type Environment struct {
+	// Platform is the detected platform, empty when none was detected.
+	Platform Platform
+	// Service is the Cloud Run service (K_SERVICE).
+	Service string
+	// Revision is the Cloud Run revision (K_REVISION).
+	Revision string
+	// Namespace is the Kubernetes namespace of the pod.
+	Namespace string
+	// Pod is the name of the Kubernetes pod.
+	Pod string
+	// Instance is the name of the Compute Engine instance.
+	Instance string
+}
+
+// DetectEnvironment detects the runtime environment from the variables set by
+// Cloud Run, the Kubernetes service account and the metadata server of
+// Compute Engine. On GKE, POD_NAME and POD_NAMESPACE take precedence when set
+// through the downward API.
+func DetectEnvironment(ctx context.Context) Environment {
+	if service := os.Getenv("K_SERVICE"); service != "" {
+		return Environment{
+			Platform: PlatformCloudRun,
+			Service:  service,
+			Revision: os.Getenv("K_REVISION"),
+		}
+	}
+
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		env := Environment{
+			Platform:  PlatformGKE,
+			Namespace: os.Getenv("POD_NAMESPACE"),
+			Pod:       os.Getenv("POD_NAME"),
+		}
+
+		if env.Pod == "" {
+			env.Pod, _ = os.Hostname()
+		}
+
+		if env.Namespace == "" {
+			if data, err := os.ReadFile(kubernetesNamespaceFile); err == nil {
+				env.Namespace = strings.TrimSpace(string(data))
+			}
+		}
+
+		return env
+	}
+
+	if metadata.OnGCEWithContext(ctx) {
+		if name, err := metadata.InstanceNameWithContext(ctx); err == nil {
+			return Environment{Platform: PlatformGCE, Instance: name}
+		}
+	}
+
+	return Environment{}
+}
+
+// RuntimeParams is an opt-in BeforeConnect hook that sets application_name and
+// other runtime parameters from the runtime environment, so that Cloud SQL
+// Query Insights attributes the load per service and revision. Parameters that
+// are already set in the connection config are kept.
+type RuntimeParams struct {
+	// Template is the text/template of application_name, executed with the
+	// Environment. Defaults to DefaultApplicationNameTemplate.
+	Template string
+	// Params are additional runtime parameters whose values are templates
+	// executed with the Environment, e.g. a search_path per service.
+	Params map[string]string
+	// Environment is the runtime environment. It is detected with
+	// DetectEnvironment on first use when nil.
+	Environment *Environment
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// BeforeConnect is a BeforeConnect hook that sets the runtime parameters of the
+// connection.
+func (x *RuntimeParams) BeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	values, err := x.resolve(ctx)
+	if err != nil {
+		return err
+	}
+
+	if conn.RuntimeParams == nil {
+		conn.RuntimeParams = make(map[string]string)
+	}
+
+	for key, value := range values {
+		// explicit settings win over the environment
+		if _, ok := conn.RuntimeParams[key]; !ok && value != "" {
+			conn.RuntimeParams[key] = value
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the runtime parameters, rendering them on first use.
+func (x *RuntimeParams) resolve(ctx context.Context) (map[string]string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.values != nil {
+		return x.values, nil
+	}
+
+	if x.Environment == nil {
+		env := DetectEnvironment(ctx)
+		x.Environment = &env
+	}
+
+	text := x.Template
+	if text == "" {
+		text = DefaultApplicationNameTemplate
+	}
+
+	name, err := render("application_name", text, x.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{"application_name": truncate(name, maxApplicationNameLength)}
+	for key, text := range x.Params {
+		if values[key], err = render(key, text, x.Environment); err != nil {
+			return nil, err
+		}
+	}
+
+	x.values = values
+	return values, nil
+}
+
+// render executes the template of the runtime parameter.
+func render(key, text string, env *Environment) (string, error) {
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("pgxgcp: invalid template of %s: %w", key, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, env); err != nil {
+		return "", fmt.Errorf("pgxgcp: invalid template of %s: %w", key, err)
+	}
+
+	return buf.String(), nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[:n]
+	// drop a partial multi-byte sequence
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,104 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+var _ = Describe("DetectEnvironment", func() {
+	It("detects Cloud Run", func() {
+		GinkgoT().Setenv("K_SERVICE", "orders")
+		GinkgoT().Setenv("K_REVISION", "orders-00042-abc")
+
+		Expect(pgxgcp.DetectEnvironment(context.Background())).To(Equal(pgxgcp.Environment{
+			Platform: pgxgcp.PlatformCloudRun,
+			Service:  "orders",
+			Revision: "orders-00042-abc",
+		}))
+	})
+
+	It("detects GKE", func() {
+		GinkgoT().Setenv("K_SERVICE", "")
+		GinkgoT().Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+		GinkgoT().Setenv("POD_NAME", "orders-7d9f-x2k")
+		GinkgoT().Setenv("POD_NAMESPACE", "shop")
+
+		Expect(pgxgcp.DetectEnvironment(context.Background())).To(Equal(pgxgcp.Environment{
+			Platform:  pgxgcp.PlatformGKE,
+			Namespace: "shop",
+			Pod:       "orders-7d9f-x2k",
+		}))
+	})
+})
+
+var _ = Describe("RuntimeParams", func() {
+	var (
+		ctx    context.Context
+		conn   *pgx.ConnConfig
+		params *pgxgcp.RuntimeParams
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		conn = &pgx.ConnConfig{}
+		params = &pgxgcp.RuntimeParams{
+			Environment: &pgxgcp.Environment{
+				Platform: pgxgcp.PlatformCloudRun,
+				Service:  "orders",
+				Revision: "orders-00042-abc",
+			},
+		}
+	})
+
+	DescribeTable("renders the default application_name",
+		func(env pgxgcp.Environment, name string) {
+			params.Environment = &env
+			Expect(params.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.RuntimeParams).To(HaveKeyWithValue("application_name", name))
+		},
+		Entry("Cloud Run", pgxgcp.Environment{Service: "orders", Revision: "orders-00042-abc"}, "orders/orders-00042-abc"),
+		Entry("GKE", pgxgcp.Environment{Namespace: "shop", Pod: "orders-7d9f-x2k"}, "shop/orders-7d9f-x2k"),
+		Entry("GCE", pgxgcp.Environment{Instance: "vm-1"}, "vm-1"),
+	)
+
+	It("renders the template and custom params", func() {
+		params.Template = "{{.Service}}@{{.Revision}}"
+		params.Params = map[string]string{"search_path": "{{.Service}},public"}
+
+		Expect(params.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.RuntimeParams).To(HaveKeyWithValue("application_name", "orders@orders-00042-abc"))
+		Expect(conn.RuntimeParams).To(HaveKeyWithValue("search_path", "orders,public"))
+	})
+
+	It("keeps explicit settings", func() {
+		conn.RuntimeParams = map[string]string{"application_name": "batch"}
+
+		Expect(params.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.RuntimeParams).To(HaveKeyWithValue("application_name", "batch"))
+	})
+
+	It("skips an empty application_name", func() {
+		params.Environment = &pgxgcp.Environment{}
+
+		Expect(params.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.RuntimeParams).NotTo(HaveKey("application_name"))
+	})
+
+	It("truncates the application_name to the Postgres limit", func() {
+		params.Environment.Service = strings.Repeat("s", 80)
+
+		Expect(params.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.RuntimeParams["application_name"]).To(HaveLen(63))
+	})
+
+	It("rejects an invalid template", func() {
+		params.Template = "{{.Unknown}}"
+
+		Expect(params.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid template of application_name")))
+	})
+})
@@ -0,0 +1,164 @@
+// Package pgxgcptest provides test helpers for code that uses pgxgcp.
+package pgxgcptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+// ErrClosed is returned by Dial after the dialer has been closed.
+var ErrClosed = errors.New("pgxgcptest: dialer closed")
+
+var _ pgxgcp.Dialer = &Dialer{}
+
+// Dialer is a fake pgxgcp.Dialer that maps instance connection names to local
+// network addresses, such as a Postgres server on localhost:5432. It lets a
+// pgxgcp.Connector be exercised end-to-end without Google Cloud.
+type Dialer struct {
+	// Instances maps instance connection names to TCP addresses, or to Unix
+	// socket paths when they start with "/".
+	Instances map[string]string
+
+	mu      sync.Mutex
+	errs    map[string]error
+	times   map[string]int
+	dials   map[string]int
+	warmups map[string]int
+	closed  bool
+}
+
+// Dial implements pgxgcp.Dialer. The dial options are ignored.
+func (d *Dialer) Dial(ctx context.Context, instance string, _ ...cloudsqlconn.DialOption) (net.Conn, error) {
+	d.mu.Lock()
+	if d.dials == nil {
+		d.dials = make(map[string]int)
+	}
+	d.dials[instance]++
+
+	closed := d.closed
+	err := d.errs[instance]
+	// a limited failure is used up by this dial
+	if n, ok := d.times[instance]; ok && err != nil {
+		if n <= 1 {
+			delete(d.errs, instance)
+			delete(d.times, instance)
+		} else {
+			d.times[instance] = n - 1
+		}
+	}
+	address, ok := d.Instances[instance]
+	d.mu.Unlock()
+
+	switch {
+	case closed:
+		return nil, ErrClosed
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, fmt.Errorf("pgxgcptest: unknown instance %q", instance)
+	}
+
+	network := "tcp"
+	if len(address) > 0 && address[0] == '/' {
+		network = "unix"
+	}
+
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Warmup mimics cloudsqlconn.Dialer.Warmup without connecting. It returns the
+// error injected with Fail, without using up a FailTimes failure. The dial
+// options are ignored.
+func (d *Dialer) Warmup(_ context.Context, instance string, _ ...cloudsqlconn.DialOption) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.warmups == nil {
+		d.warmups = make(map[string]int)
+	}
+	d.warmups[instance]++
+
+	_, ok := d.Instances[instance]
+
+	switch {
+	case d.closed:
+		return ErrClosed
+	case d.errs[instance] != nil:
+		return d.errs[instance]
+	case !ok:
+		return fmt.Errorf("pgxgcptest: unknown instance %q", instance)
+	}
+
+	return nil
+}
+
+// Fail makes every following Dial of the instance return err. A nil err
+// restores normal dialing.
+func (d *Dialer) Fail(instance string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.errs == nil {
+		d.errs = make(map[string]error)
+	}
+
+	delete(d.times, instance)
+
+	if err == nil {
+		delete(d.errs, instance)
+		return
+	}
+
+	d.errs[instance] = err
+}
+
+// FailTimes makes the next n Dials of the instance return err, after which
+// normal dialing resumes. It simulates a transient failure.
+func (d *Dialer) FailTimes(instance string, n int, err error) {
+	d.Fail(instance, err)
+
+	if n <= 0 || err == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.times == nil {
+		d.times = make(map[string]int)
+	}
+
+	d.times[instance] = n
+}
+
+// Dials returns the number of times the instance has been dialed.
+func (d *Dialer) Dials(instance string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.dials[instance]
+}
+
+// Warmups returns the number of times the instance has been warmed up.
+func (d *Dialer) Warmups(instance string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.warmups[instance]
+}
+
+// Close implements pgxgcp.Dialer.
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,90 @@
+package pgxgcptest_test
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("Dialer", func() {
+	var (
+		ctx      context.Context
+		listener net.Listener
+		dialer   *pgxgcptest.Dialer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{
+				"project:region:instance": listener.Addr().String(),
+			},
+		}
+	})
+
+	It("dials the mapped address", func() {
+		conn, err := dialer.Dial(ctx, "project:region:instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.RemoteAddr().String()).To(Equal(listener.Addr().String()))
+		Expect(conn.Close()).To(Succeed())
+		Expect(dialer.Dials("project:region:instance")).To(Equal(1))
+	})
+
+	It("rejects an unknown instance", func() {
+		_, err := dialer.Dial(ctx, "project:region:unknown")
+		Expect(err).To(MatchError(ContainSubstring("unknown instance")))
+	})
+
+	It("returns the injected error", func() {
+		failure := errors.New("boom")
+		dialer.Fail("project:region:instance", failure)
+
+		_, err := dialer.Dial(ctx, "project:region:instance")
+		Expect(err).To(MatchError(failure))
+
+		dialer.Fail("project:region:instance", nil)
+
+		conn, err := dialer.Dial(ctx, "project:region:instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	It("returns the injected error a limited number of times", func() {
+		failure := errors.New("boom")
+		dialer.FailTimes("project:region:instance", 2, failure)
+
+		for range 2 {
+			_, err := dialer.Dial(ctx, "project:region:instance")
+			Expect(err).To(MatchError(failure))
+		}
+
+		conn, err := dialer.Dial(ctx, "project:region:instance")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conn.Close()).To(Succeed())
+	})
+
+	It("warms up without dialing", func() {
+		Expect(dialer.Warmup(ctx, "project:region:instance")).To(Succeed())
+		Expect(dialer.Warmups("project:region:instance")).To(Equal(1))
+		Expect(dialer.Dials("project:region:instance")).To(BeZero())
+
+		Expect(dialer.Warmup(ctx, "project:region:unknown")).To(MatchError(ContainSubstring("unknown instance")))
+	})
+
+	It("refuses to dial after Close", func() {
+		Expect(dialer.Close()).To(Succeed())
+
+		_, err := dialer.Dial(ctx, "project:region:instance")
+		Expect(err).To(MatchError(pgxgcptest.ErrClosed))
+	})
+})
@@ -0,0 +1,148 @@
+package pgxgcptest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// secretVersionPattern matches the resource name of a secret version.
+var secretVersionPattern = regexp.MustCompile(`^(projects/[^/]+/secrets/[^/]+)/versions/([^/]+)$`)
+
+// SecretManager is a fake Secret Manager server that serves secret versions
+// from memory over gRPC on localhost. Only AccessSecretVersion is implemented.
+type SecretManager struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+
+	// Latency delays every response.
+	Latency time.Duration
+
+	mu       sync.Mutex
+	server   *grpc.Server
+	address  string
+	secrets  map[string][][]byte
+	accesses map[string]int
+}
+
+// Start starts the server on a free port of localhost.
+func (s *SecretManager) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, s)
+
+	s.mu.Lock()
+	s.server = server
+	s.address = listener.Addr().String()
+	s.mu.Unlock()
+
+	go server.Serve(listener)
+
+	return nil
+}
+
+// ClientOptions returns the options that connect a Secret Manager client to
+// the server.
+func (s *SecretManager) ClientOptions() []option.ClientOption {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return []option.ClientOption{
+		option.WithEndpoint(s.address),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// Close stops the server.
+func (s *SecretManager) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		s.server.Stop()
+	}
+
+	return nil
+}
+
+// AddVersion adds a version with the given payload to the secret, such
+// as projects/PROJECT/secrets/SECRET, and returns the name of the version.
+func (s *SecretManager) AddVersion(secret string, payload string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secrets == nil {
+		s.secrets = make(map[string][][]byte)
+	}
+
+	s.secrets[secret] = append(s.secrets[secret], []byte(payload))
+
+	return fmt.Sprintf("%s/versions/%d", secret, len(s.secrets[secret]))
+}
+
+// Accesses returns the number of times the secret version has been accessed,
+// by the name it was requested with.
+func (s *SecretManager) Accesses(version string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accesses[version]
+}
+
+// AccessSecretVersion implements secretmanagerpb.SecretManagerServiceServer.
+func (s *SecretManager) AccessSecretVersion(ctx context.Context, request *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	if s.Latency > 0 {
+		select {
+		case <-time.After(s.Latency):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accesses == nil {
+		s.accesses = make(map[string]int)
+	}
+	s.accesses[request.GetName()]++
+
+	match := secretVersionPattern.FindStringSubmatch(request.GetName())
+	if match == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid secret version %q", request.GetName())
+	}
+
+	versions := s.secrets[match[1]]
+	if len(versions) == 0 {
+		return nil, status.Errorf(codes.NotFound, "secret %q not found", match[1])
+	}
+
+	index := len(versions)
+	if match[2] != "latest" {
+		number, err := strconv.Atoi(match[2])
+		if err != nil || number < 1 || number > len(versions) {
+			return nil, status.Errorf(codes.NotFound, "secret version %q not found", request.GetName())
+		}
+		index = number
+	}
+
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    fmt.Sprintf("%s/versions/%d", match[1], index),
+		Payload: &secretmanagerpb.SecretPayload{Data: versions[index-1]},
+	}, nil
+}
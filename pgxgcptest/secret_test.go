@@ -0,0 +1,56 @@
+package pgxgcptest_test
+
+import (
+	"context"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("SecretManager", func() {
+	var (
+		ctx    context.Context
+		server *pgxgcptest.SecretManager
+		client *secretmanager.Client
+	)
+
+	access := func(name string) (string, error) {
+		response, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+		if err != nil {
+			return "", err
+		}
+		return string(response.GetPayload().GetData()), nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		server = &pgxgcptest.SecretManager{}
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Close)
+
+		var err error
+		client, err = secretmanager.NewClient(ctx, server.ClientOptions()...)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	It("serves the latest and numbered versions", func() {
+		Expect(server.AddVersion("projects/p/secrets/db", "first")).To(Equal("projects/p/secrets/db/versions/1"))
+		Expect(server.AddVersion("projects/p/secrets/db", "second")).To(Equal("projects/p/secrets/db/versions/2"))
+
+		Expect(access("projects/p/secrets/db/versions/latest")).To(Equal("second"))
+		Expect(access("projects/p/secrets/db/versions/1")).To(Equal("first"))
+		Expect(server.Accesses("projects/p/secrets/db/versions/latest")).To(Equal(1))
+	})
+
+	It("rejects an unknown secret", func() {
+		_, err := access("projects/p/secrets/unknown/versions/latest")
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+})
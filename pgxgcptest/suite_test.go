@@ -0,0 +1,13 @@
+package pgxgcptest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPgxgcptest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "pgxgcptest Suite")
+}
@@ -0,0 +1,195 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// StateKey is the attribute key of the state of pool connections: idle,
+	// acquired or constructing.
+	StateKey = attribute.Key("state")
+	// ReasonKey is the attribute key of the reason a pool connection was
+	// destroyed: max_lifetime or max_idle.
+	ReasonKey = attribute.Key("reason")
+)
+
+// PoolMetrics publishes the statistics of a pgxpool.Pool as OpenTelemetry
+// metrics labelled with the Cloud SQL instance of the pool. The metrics are
+// observed each time the meter provider collects, e.g. by the periodic reader
+// of the Google Cloud Monitoring exporter.
+type PoolMetrics struct {
+	// Pool is the pool to observe.
+	Pool *pgxpool.Pool
+	// Connector resolves the instance of a pool whose host is a logical
+	// database host of Connector.Failover to its active instance. The host of
+	// the pool is used as is when nil.
+	Connector *Connector
+	// Instance is the cloudsql.instance label of the metrics, e.g. for a pool
+	// balanced across read replicas. Defaults to the instance of the host of
+	// the pool.
+	Instance string
+	// Attributes are added to every metric, e.g. the service name.
+	Attributes []attribute.KeyValue
+	// MeterProvider provides the meter used to record the metrics. Defaults to
+	// the global OpenTelemetry meter provider.
+	MeterProvider metric.MeterProvider
+
+	mu           sync.Mutex
+	registration metric.Registration
+}
+
+// Start registers the metrics with the meter provider.
+func (x *PoolMetrics) Start() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.registration != nil {
+		return errors.New("pgxgcp: pool metrics already started")
+	}
+
+	provider := x.MeterProvider
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+
+	meter := provider.Meter(ScopeName)
+
+	connections, err := meter.Int64ObservableUpDownCounter("pgxgcp.pool.connections",
+		metric.WithDescription("Number of connections in the pool by state."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	limit, err := meter.Int64ObservableUpDownCounter("pgxgcp.pool.connections.max",
+		metric.WithDescription("Maximum size of the pool."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	created, err := meter.Int64ObservableCounter("pgxgcp.pool.connections.created",
+		metric.WithDescription("Number of connections opened by the pool."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	destroyed, err := meter.Int64ObservableCounter("pgxgcp.pool.connections.destroyed",
+		metric.WithDescription("Number of connections closed by the pool by reason."),
+		metric.WithUnit("{connection}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	acquires, err := meter.Int64ObservableCounter("pgxgcp.pool.acquires",
+		metric.WithDescription("Number of successful acquires from the pool."),
+		metric.WithUnit("{acquire}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	canceled, err := meter.Int64ObservableCounter("pgxgcp.pool.acquires.canceled",
+		metric.WithDescription("Number of acquires canceled by their context."),
+		metric.WithUnit("{acquire}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	empty, err := meter.Int64ObservableCounter("pgxgcp.pool.acquires.empty",
+		metric.WithDescription("Number of successful acquires that waited for a connection because the pool was empty."),
+		metric.WithUnit("{acquire}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	duration, err := meter.Float64ObservableCounter("pgxgcp.pool.acquire.duration",
+		metric.WithDescription("Total time spent in successful acquires."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	wait, err := meter.Float64ObservableCounter("pgxgcp.pool.acquire.wait",
+		metric.WithDescription("Total time successful acquires waited for a connection because the pool was empty."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	callback := func(_ context.Context, observer metric.Observer) error {
+		stat := x.Pool.Stat()
+
+		attributes := append([]attribute.KeyValue{InstanceKey.String(x.instance())}, x.Attributes...)
+		// with adds further attributes to the common ones
+		with := func(extra ...attribute.KeyValue) metric.ObserveOption {
+			return metric.WithAttributes(append(extra, attributes...)...)
+		}
+
+		observer.ObserveInt64(connections, int64(stat.IdleConns()), with(StateKey.String("idle")))
+		observer.ObserveInt64(connections, int64(stat.AcquiredConns()), with(StateKey.String("acquired")))
+		observer.ObserveInt64(connections, int64(stat.ConstructingConns()), with(StateKey.String("constructing")))
+		observer.ObserveInt64(limit, int64(stat.MaxConns()), with())
+		observer.ObserveInt64(created, stat.NewConnsCount(), with())
+		observer.ObserveInt64(destroyed, stat.MaxLifetimeDestroyCount(), with(ReasonKey.String("max_lifetime")))
+		observer.ObserveInt64(destroyed, stat.MaxIdleDestroyCount(), with(ReasonKey.String("max_idle")))
+		observer.ObserveInt64(acquires, stat.AcquireCount(), with())
+		observer.ObserveInt64(canceled, stat.CanceledAcquireCount(), with())
+		observer.ObserveInt64(empty, stat.EmptyAcquireCount(), with())
+		observer.ObserveFloat64(duration, stat.AcquireDuration().Seconds(), with())
+		observer.ObserveFloat64(wait, stat.EmptyAcquireWaitTime().Seconds(), with())
+
+		return nil
+	}
+
+	x.registration, err = meter.RegisterCallback(callback,
+		connections, limit, created, destroyed, acquires, canceled, empty, duration, wait,
+	)
+
+	return err
+}
+
+// Close unregisters the metrics. It does not close the pool.
+func (x *PoolMetrics) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.registration == nil {
+		return nil
+	}
+
+	err := x.registration.Unregister()
+	x.registration = nil
+
+	return err
+}
+
+// instance returns the instance connection name of the pool.
+func (x *PoolMetrics) instance() string {
+	if x.Instance != "" {
+		return x.Instance
+	}
+
+	host := x.Pool.Config().ConnConfig.Host
+	if x.Connector != nil {
+		return x.Connector.Active(host)
+	}
+
+	return host
+}
@@ -0,0 +1,130 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ = Describe("PoolMetrics", func() {
+	var (
+		ctx     context.Context
+		reader  *sdkmetric.ManualReader
+		metrics *pgxgcp.PoolMetrics
+	)
+
+	// collect returns the data points recorded so far by metric name.
+	collect := func() map[string]metricdata.Aggregation {
+		data := metricdata.ResourceMetrics{}
+		Expect(reader.Collect(ctx, &data)).To(Succeed())
+
+		points := make(map[string]metricdata.Aggregation)
+		for _, scope := range data.ScopeMetrics {
+			for _, item := range scope.Metrics {
+				points[item.Name] = item.Data
+			}
+		}
+		return points
+	}
+
+	// value returns the int64 sum data point with the attributes, or -1 when
+	// there is none.
+	value := func(data metricdata.Aggregation, attrs ...attribute.KeyValue) int64 {
+		set := attribute.NewSet(attrs...)
+		for _, point := range data.(metricdata.Sum[int64]).DataPoints {
+			if point.Attributes.Equals(&set) {
+				return point.Value
+			}
+		}
+		return -1
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		reader = sdkmetric.NewManualReader()
+
+		config, err := pgxpool.ParseConfig("host=orders user=postgres pool_max_conns=4")
+		Expect(err).NotTo(HaveOccurred())
+
+		pool, err := pgxpool.NewWithConfig(ctx, config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(pool.Close)
+
+		metrics = &pgxgcp.PoolMetrics{
+			Pool: pool,
+			Connector: &pgxgcp.Connector{
+				Failover: map[string][]string{"orders": {"project:region:orders", "project:region:orders-dr"}},
+			},
+			Attributes:    []attribute.KeyValue{attribute.String("service", "checkout")},
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		}
+		Expect(metrics.Start()).To(Succeed())
+		DeferCleanup(metrics.Close)
+	})
+
+	It("labels the statistics with the active instance", func() {
+		points := collect()
+
+		instance := pgxgcp.InstanceKey.String("project:region:orders")
+		service := attribute.String("service", "checkout")
+
+		Expect(value(points["pgxgcp.pool.connections.max"], instance, service)).To(BeEquivalentTo(4))
+		Expect(value(points["pgxgcp.pool.connections"], instance, service, pgxgcp.StateKey.String("idle"))).To(BeZero())
+		Expect(value(points["pgxgcp.pool.acquires"], instance, service)).To(BeZero())
+		Expect(points).To(HaveKey("pgxgcp.pool.acquire.duration"))
+		Expect(points).To(HaveKey("pgxgcp.pool.connections.destroyed"))
+	})
+
+	It("labels the statistics with an explicit instance", func() {
+		metrics.Instance = "orders-replicas"
+
+		instance := pgxgcp.InstanceKey.String("orders-replicas")
+		service := attribute.String("service", "checkout")
+
+		Expect(value(collect()["pgxgcp.pool.connections.max"], instance, service)).To(BeEquivalentTo(4))
+	})
+
+	It("refuses to start twice", func() {
+		Expect(metrics.Start()).To(MatchError(ContainSubstring("already started")))
+	})
+
+	It("stops publishing once closed", func() {
+		Expect(metrics.Close()).To(Succeed())
+		Expect(collect()).NotTo(HaveKey("pgxgcp.pool.connections"))
+	})
+
+	Describe("Integration", func() {
+		It("counts the acquires", func() {
+			url := os.Getenv("PGX_DATABASE_URL")
+			if url == "" {
+				Skip("PGX_DATABASE_URL not set")
+			}
+
+			pool, err := pgxpool.New(ctx, url)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(pool.Close)
+
+			Expect(metrics.Close()).To(Succeed())
+			metrics.Pool = pool
+			metrics.Connector = nil
+			Expect(metrics.Start()).To(Succeed())
+
+			conn, err := pool.Acquire(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			conn.Release()
+
+			points := collect()
+			instance := pgxgcp.InstanceKey.String(pool.Config().ConnConfig.Host)
+			service := attribute.String("service", "checkout")
+			Expect(value(points["pgxgcp.pool.acquires"], instance, service)).To(BeEquivalentTo(1))
+			Expect(value(points["pgxgcp.pool.connections"], instance, service, pgxgcp.StateKey.String("idle"))).To(BeEquivalentTo(1))
+		})
+	})
+})
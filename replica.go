@@ -0,0 +1,221 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReplicaBalancer selects the order in which read replicas are dialed.
+type ReplicaBalancer int
+
+const (
+	// RoundRobin dials the replicas in turn.
+	RoundRobin ReplicaBalancer = iota
+	// LeastConnections dials the replica with the fewest open connections
+	// first.
+	LeastConnections
+)
+
+// DefaultReplicaCooldown is the time a replica that failed to dial is skipped
+// when ReplicaConnector.Cooldown is zero.
+const DefaultReplicaCooldown = 30 * time.Second
+
+// ReplicaConnector routes connections between a Cloud SQL primary instance and
+// its read replicas. BeforeConnect balances new connections across the healthy
+// replicas and falls back to the primary when none of them can be dialed.
+// PrimaryBeforeConnect always dials the primary. The primary may be a logical
+// database host of Connector.Failover, in which case its active instance is
+// dialed.
+type ReplicaConnector struct {
+	// Connector is the underlying connector used to dial the instances.
+	Connector *Connector
+	// Primary is the instance connection name of the primary instance.
+	Primary string
+	// Replicas are the instance connection names of the read replicas.
+	Replicas []string
+	// Balancer selects the order in which the replicas are dialed.
+	Balancer ReplicaBalancer
+	// Cooldown is the time a replica that failed to dial is skipped. Defaults to
+	// DefaultReplicaCooldown.
+	Cooldown time.Duration
+
+	mu     sync.Mutex
+	next   int
+	open   map[string]int
+	failed map[string]time.Time
+}
+
+// Configs returns a copy of config for the primary and a copy for the read
+// replicas, each with the host and BeforeConnect hook set. The host of the
+// replica config is the first replica, so the pool is not reported as the
+// primary.
+func (x *ReplicaConnector) Configs(config *pgxpool.Config) (primary *pgxpool.Config, replica *pgxpool.Config) {
+	primary = config.Copy()
+	primary.ConnConfig.Host = x.Primary
+	primary.BeforeConnect = x.PrimaryBeforeConnect
+
+	replica = config.Copy()
+	replica.ConnConfig.Host = x.Primary
+	if len(x.Replicas) > 0 {
+		replica.ConnConfig.Host = x.Replicas[0]
+	}
+	replica.BeforeConnect = x.BeforeConnect
+
+	return primary, replica
+}
+
+// PrimaryBeforeConnect is a BeforeConnect hook that connects to the primary
+// instance.
+func (x *ReplicaConnector) PrimaryBeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	conn.Host = x.Primary
+	return x.Connector.BeforeConnect(ctx, conn)
+}
+
+// BeforeConnect is a BeforeConnect hook that connects to one of the read
+// replicas, or to the primary when no replica can be dialed.
+func (x *ReplicaConnector) BeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	for _, name := range append([]string{x.Primary}, x.Replicas...) {
+		ok, err := x.Connector.match(name)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return fmt.Errorf("pgxgcp: %q is not a Cloud SQL instance", name)
+		}
+	}
+
+	validate := conn.ValidateConnect
+	// let the connector prepare the config for the primary
+	if err := x.PrimaryBeforeConnect(ctx, conn); err != nil {
+		return err
+	}
+	// replicas are in recovery by design, so the writable check a failover
+	// primary installs does not apply
+	conn.ValidateConnect = validate
+
+	conn.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+		var errs []error
+
+		for _, name := range x.candidates() {
+			// dial the replica
+			c, err := x.Connector.dial(ctx, x.Connector.Active(name))
+			if err == nil {
+				return x.track(name, c), nil
+			}
+
+			x.fail(name)
+			errs = append(errs, err)
+
+			if ctx.Err() != nil {
+				return nil, errors.Join(errs...)
+			}
+		}
+
+		// all replicas failed, fall back to the active instance of the primary
+		c, err := x.Connector.dial(ctx, x.Connector.Active(x.Primary))
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+
+		return x.track(x.Primary, c), nil
+	}
+
+	return nil
+}
+
+// Open returns the number of open connections per instance created through
+// the connector.
+func (x *ReplicaConnector) Open() map[string]int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	open := make(map[string]int, len(x.open))
+	for name, count := range x.open {
+		open[name] = count
+	}
+
+	return open
+}
+
+// candidates returns the healthy replicas in the order they should be dialed.
+func (x *ReplicaConnector) candidates() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	cooldown := x.Cooldown
+	if cooldown == 0 {
+		cooldown = DefaultReplicaCooldown
+	}
+
+	now := time.Now()
+	// skip the replicas in cooldown
+	healthy := make([]string, 0, len(x.Replicas))
+	for _, name := range x.Replicas {
+		if at, ok := x.failed[name]; ok && now.Sub(at) < cooldown {
+			continue
+		}
+		healthy = append(healthy, name)
+	}
+
+	if len(healthy) == 0 {
+		return healthy
+	}
+
+	switch x.Balancer {
+	case LeastConnections:
+		// stable sort keeps the configured order between equal counts
+		slices.SortStableFunc(healthy, func(a, b string) int {
+			return x.open[a] - x.open[b]
+		})
+	default:
+		// rotate the replicas so that each dial starts at the next one
+		offset := x.next % len(healthy)
+		healthy = slices.Concat(healthy[offset:], healthy[:offset])
+		x.next++
+	}
+
+	return healthy
+}
+
+// fail puts the replica in cooldown.
+func (x *ReplicaConnector) fail(name string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.failed == nil {
+		x.failed = make(map[string]time.Time)
+	}
+
+	x.failed[name] = time.Now()
+}
+
+// track counts the connection as open until it is closed.
+func (x *ReplicaConnector) track(name string, conn net.Conn) net.Conn {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.open == nil {
+		x.open = make(map[string]int)
+	}
+
+	delete(x.failed, name)
+	x.open[name]++
+
+	return &trackedConn{
+		Conn: conn,
+		done: func() {
+			x.mu.Lock()
+			defer x.mu.Unlock()
+
+			x.open[name]--
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("ReplicaConnector", func() {
+	var (
+		ctx       context.Context
+		connector *pgxgcp.ReplicaConnector
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		connector = &pgxgcp.ReplicaConnector{
+			Connector: &pgxgcp.Connector{},
+			Primary:   "project:region:primary",
+			Replicas:  []string{"project:region:replica-a", "project:region:replica-b"},
+		}
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("Configs", func() {
+		It("returns a primary and a replica config", func() {
+			config, err := pgxpool.ParseConfig("user=postgres dbname=app")
+			Expect(err).NotTo(HaveOccurred())
+
+			primary, replica := connector.Configs(config)
+			Expect(primary).NotTo(BeIdenticalTo(config))
+			Expect(replica).NotTo(BeIdenticalTo(config))
+			Expect(primary.ConnConfig.Host).To(Equal("project:region:primary"))
+			Expect(replica.ConnConfig.Host).To(Equal("project:region:replica-a"))
+			Expect(primary.BeforeConnect).NotTo(BeNil())
+			Expect(replica.BeforeConnect).NotTo(BeNil())
+			Expect(config.BeforeConnect).To(BeNil())
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("PrimaryBeforeConnect", func() {
+		It("points the conn config at the primary", func() {
+			conn := &pgx.ConnConfig{}
+
+			Expect(connector.PrimaryBeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.Host).To(Equal("project:region:primary"))
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("BeforeConnect", func() {
+		It("sets DialFunc on the conn config", func() {
+			conn := &pgx.ConnConfig{}
+
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+			Expect(conn.DialFunc).NotTo(BeNil())
+		})
+
+		It("rejects a malformed replica name", func() {
+			connector.Replicas = append(connector.Replicas, "project:replica-c")
+
+			conn := &pgx.ConnConfig{}
+			Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid Cloud SQL instance connection name")))
+		})
+
+		It("rejects a replica that is not a Cloud SQL instance", func() {
+			connector.Replicas = append(connector.Replicas, "localhost")
+
+			conn := &pgx.ConnConfig{}
+			Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("is not a Cloud SQL instance")))
+		})
+
+		It("rejects a malformed primary name", func() {
+			connector.Primary = "project:primary"
+
+			conn := &pgx.ConnConfig{}
+			Expect(connector.BeforeConnect(ctx, conn)).To(MatchError(ContainSubstring("invalid Cloud SQL instance connection name")))
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("Open", func() {
+		It("is empty before any connection is made", func() {
+			Expect(connector.Open()).To(BeEmpty())
+		})
+	})
+
+	// -------------------------------------------------------------------------
+	Describe("DialFunc", func() {
+		var (
+			dialer    *pgxgcptest.Dialer
+			addresses map[string]string
+		)
+
+		// dial opens a connection through the replica hook and returns the
+		// instance that accepted it.
+		dial := func() (string, net.Conn) {
+			conn := &pgx.ConnConfig{}
+			Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+			c, err := conn.DialFunc(ctx, "tcp", "")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() { _ = c.Close() })
+
+			for name, address := range addresses {
+				if c.RemoteAddr().String() == address {
+					return name, c
+				}
+			}
+
+			Fail("connection to an unknown address")
+			return "", nil
+		}
+
+		BeforeEach(func() {
+			addresses = map[string]string{
+				"project:region:primary":   listen(),
+				"project:region:replica-a": listen(),
+				"project:region:replica-b": listen(),
+			}
+			dialer = &pgxgcptest.Dialer{Instances: addresses}
+			connector.Connector.Dialer = dialer
+		})
+
+		It("balances connections round-robin", func() {
+			first, _ := dial()
+			second, _ := dial()
+			third, _ := dial()
+
+			Expect([]string{first, second}).To(ConsistOf("project:region:replica-a", "project:region:replica-b"))
+			Expect(third).To(Equal(first))
+			Expect(connector.Open()).To(HaveKeyWithValue(first, 2))
+		})
+
+		It("prefers the replica with the fewest connections", func() {
+			connector.Balancer = pgxgcp.LeastConnections
+
+			first, c := dial()
+			Expect(first).To(Equal("project:region:replica-a"))
+			second, _ := dial()
+			Expect(second).To(Equal("project:region:replica-b"))
+
+			// closing the connection frees replica-a
+			Expect(c.Close()).To(Succeed())
+			third, _ := dial()
+			Expect(third).To(Equal("project:region:replica-a"))
+		})
+
+		It("skips a replica that fails to dial", func() {
+			dialer.Fail("project:region:replica-a", errors.New("maintenance"))
+
+			for range 3 {
+				name, _ := dial()
+				Expect(name).To(Equal("project:region:replica-b"))
+			}
+
+			// the failed replica is in cooldown
+			Expect(dialer.Dials("project:region:replica-a")).To(Equal(1))
+		})
+
+		It("falls back to the primary when all replicas fail", func() {
+			dialer.Fail("project:region:replica-a", errors.New("maintenance"))
+			dialer.Fail("project:region:replica-b", errors.New("maintenance"))
+
+			name, _ := dial()
+			Expect(name).To(Equal("project:region:primary"))
+		})
+
+		Context("with a failover primary", func() {
+			BeforeEach(func() {
+				addresses["project:region:primary-dr"] = listen()
+				connector.Connector.Failover = map[string][]string{
+					"orders": {"project:region:primary", "project:region:primary-dr"},
+				}
+				connector.Primary = "orders"
+			})
+
+			It("does not require the replicas to be writable", func() {
+				conn := &pgx.ConnConfig{}
+				Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+				Expect(conn.ValidateConnect).To(BeNil())
+			})
+
+			It("keeps the writable check on the primary config", func() {
+				conn := &pgx.ConnConfig{}
+				Expect(connector.PrimaryBeforeConnect(ctx, conn)).To(Succeed())
+				Expect(conn.ValidateConnect).NotTo(BeNil())
+			})
+
+			It("falls back to the active instance of the primary", func() {
+				dialer.Fail("project:region:replica-a", errors.New("maintenance"))
+				dialer.Fail("project:region:replica-b", errors.New("maintenance"))
+
+				name, _ := dial()
+				Expect(name).To(Equal("project:region:primary"))
+				Expect(dialer.Dials("orders")).To(BeZero())
+			})
+		})
+	})
+})
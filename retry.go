@@ -0,0 +1,157 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtype"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultRetryInitialBackoff is the backoff before the first retry when
+	// RetryPolicy.InitialBackoff is zero.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the upper bound of the backoff when
+	// RetryPolicy.MaxBackoff is zero.
+	DefaultRetryMaxBackoff = 5 * time.Second
+	// DefaultRetryMultiplier is the growth factor of the backoff when
+	// RetryPolicy.Multiplier is zero.
+	DefaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy configures how the Connector retries a failed dial. Only errors
+// for which Retryable reports true are retried, and never past the deadline of
+// the dial context.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of dials, including the first one.
+	// Values below two disable retries.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry. Defaults to
+	// DefaultRetryInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper bound of the backoff. Defaults to
+	// DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each retry.
+	// Defaults to DefaultRetryMultiplier.
+	Multiplier float64
+}
+
+// backoff returns the randomised backoff before the given retry, starting at
+// one. The delay is drawn uniformly from the upper half of the exponential
+// backoff, so concurrent dials do not retry in lockstep.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	initial := p.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+
+	limit := p.MaxBackoff
+	if limit <= 0 {
+		limit = DefaultRetryMaxBackoff
+	}
+
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+
+	delay := float64(initial)
+	for range retry - 1 {
+		delay *= multiplier
+		if delay >= float64(limit) {
+			break
+		}
+	}
+	delay = min(delay, float64(limit))
+
+	return time.Duration(delay/2 + rand.Float64()*delay/2)
+}
+
+// RetryError is returned when a dial failed after one or more attempts of the
+// RetryPolicy. Err is the error of the last attempt.
+type RetryError struct {
+	// Instance is the instance connection name that was dialed.
+	Instance string
+	// Attempts is the number of dials made.
+	Attempts int
+	// Err is the error of the last attempt.
+	Err error
+}
+
+// Error implements error.
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("pgxgcp: dial %s failed after %d attempts: %v", e.Instance, e.Attempts, e.Err)
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether a failed dial may succeed when retried. Refresh
+// errors and timeouts are retryable; configuration errors, authorization
+// failures of the Cloud SQL Admin API and canceled dials are not.
+func Retryable(err error) bool {
+	var (
+		configErr  *errtype.ConfigError
+		refreshErr *errtype.RefreshError
+		apiErr     *googleapi.Error
+		netErr     net.Error
+	)
+
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &configErr):
+		return false
+	case errors.As(err, &apiErr):
+		// only rate limits and server errors of the Admin API are transient
+		return apiErr.Code == http.StatusTooManyRequests || apiErr.Code >= http.StatusInternalServerError
+	case errors.As(err, &refreshErr):
+		return true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	default:
+		return false
+	}
+}
+
+// retry calls dial until it succeeds, fails with an error that is not
+// retryable, the attempts of the policy are used up or the next backoff would
+// exceed the deadline of ctx.
+func (p *RetryPolicy) retry(ctx context.Context, instance string, dial func(context.Context) (net.Conn, error)) (net.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		conn, err := dial(ctx)
+		if err == nil {
+			return conn, nil
+		}
+
+		if attempt >= p.MaxAttempts || !Retryable(err) || ctx.Err() != nil {
+			return nil, &RetryError{Instance: instance, Attempts: attempt, Err: err}
+		}
+
+		delay := p.backoff(attempt)
+		// give up early rather than sleep past the deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, &RetryError{Instance: instance, Attempts: attempt, Err: err}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &RetryError{Instance: instance, Attempts: attempt, Err: errors.Join(err, ctx.Err())}
+		case <-timer.C:
+		}
+	}
+}
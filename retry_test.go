@@ -0,0 +1,126 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtype"
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+	"google.golang.org/api/googleapi"
+)
+
+var _ = Describe("Retryable", func() {
+	DescribeTable("classifies dial errors",
+		func(err error, retryable bool) {
+			Expect(pgxgcp.Retryable(err)).To(Equal(retryable))
+		},
+		Entry("refresh", errtype.NewRefreshError("no cert", "p:r:i", errors.New("eof")), true),
+		Entry("refresh server error", errtype.NewRefreshError("no cert", "p:r:i", &googleapi.Error{Code: http.StatusServiceUnavailable}), true),
+		Entry("refresh rate limit", errtype.NewRefreshError("no cert", "p:r:i", &googleapi.Error{Code: http.StatusTooManyRequests}), true),
+		Entry("refresh forbidden", errtype.NewRefreshError("no cert", "p:r:i", &googleapi.Error{Code: http.StatusForbidden}), false),
+		Entry("refresh unauthorized", errtype.NewRefreshError("no cert", "p:r:i", &googleapi.Error{Code: http.StatusUnauthorized}), false),
+		Entry("dial timeout", errtype.NewDialError("handshake", "p:r:i", os.ErrDeadlineExceeded), true),
+		Entry("deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), true),
+		Entry("dial refused", errtype.NewDialError("handshake", "p:r:i", errors.New("refused")), false),
+		Entry("config", errtype.NewConfigError("bad name", "p:r:i"), false),
+		Entry("canceled", context.Canceled, false),
+		Entry("nil", nil, false),
+	)
+})
+
+var _ = Describe("RetryPolicy", func() {
+	var (
+		ctx       context.Context
+		dialer    *pgxgcptest.Dialer
+		connector *pgxgcp.Connector
+	)
+
+	dial := func(ctx context.Context) error {
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+
+	refresh := errtype.NewRefreshError("no cert", "project:region:instance", errors.New("eof"))
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{"project:region:instance": listen()},
+		}
+		connector = &pgxgcp.Connector{
+			Dialer: dialer,
+			Retry: &pgxgcp.RetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     5 * time.Millisecond,
+			},
+		}
+	})
+
+	It("retries a transient failure", func() {
+		dialer.FailTimes("project:region:instance", 2, refresh)
+
+		Expect(dial(ctx)).To(Succeed())
+		Expect(dialer.Dials("project:region:instance")).To(Equal(3))
+	})
+
+	It("gives up after the maximum attempts", func() {
+		dialer.Fail("project:region:instance", refresh)
+
+		err := dial(ctx)
+
+		var retryErr *pgxgcp.RetryError
+		Expect(errors.As(err, &retryErr)).To(BeTrue())
+		Expect(retryErr.Attempts).To(Equal(3))
+		Expect(retryErr.Instance).To(Equal("project:region:instance"))
+		Expect(err).To(MatchError(refresh))
+		Expect(dialer.Dials("project:region:instance")).To(Equal(3))
+	})
+
+	It("does not retry a configuration error", func() {
+		dialer.Fail("project:region:instance", errtype.NewConfigError("bad ip type", "project:region:instance"))
+
+		err := dial(ctx)
+
+		var configErr *errtype.ConfigError
+		Expect(errors.As(err, &configErr)).To(BeTrue())
+		Expect(dialer.Dials("project:region:instance")).To(Equal(1))
+	})
+
+	It("does not sleep past the context deadline", func() {
+		connector.Retry.InitialBackoff = time.Minute
+		connector.Retry.MaxBackoff = time.Minute
+		dialer.Fail("project:region:instance", refresh)
+
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		DeferCleanup(cancel)
+
+		start := time.Now()
+		Expect(dial(ctx)).To(MatchError(refresh))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(dialer.Dials("project:region:instance")).To(Equal(1))
+	})
+
+	It("does not retry without a policy", func() {
+		connector.Retry = nil
+		dialer.FailTimes("project:region:instance", 1, refresh)
+
+		Expect(dial(ctx)).To(MatchError(refresh))
+		Expect(dialer.Dials("project:region:instance")).To(Equal(1))
+	})
+})
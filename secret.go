@@ -0,0 +1,213 @@
+package pgxgcp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultSecretRefreshInterval is the age after which a cached password is
+// fetched again when SecretPassword.RefreshInterval is zero.
+const DefaultSecretRefreshInterval = 5 * time.Minute
+
+// invalidPasswordCode is the SQLSTATE of a failed password authentication.
+const invalidPasswordCode = "28P01"
+
+// SecretPassword resolves the Postgres password from a Secret Manager secret
+// version, for instances where IAM database authentication is not possible.
+// The password is cached in memory, fetched again once it is older than
+// RefreshInterval and right after the server rejects it with SQLSTATE 28P01,
+// so a rotated password is picked up without a redeploy.
+type SecretPassword struct {
+	// Client is the Secret Manager client.
+	Client *secretmanager.Client
+	// Secret is the resource name of the secret version, such as
+	// projects/PROJECT/secrets/SECRET/versions/VERSION. A secret name without a
+	// version refers to its latest version.
+	Secret string
+	// RefreshInterval is the age after which the cached password is fetched
+	// again. Defaults to DefaultSecretRefreshInterval.
+	RefreshInterval time.Duration
+
+	group    singleflight.Group
+	mu       sync.Mutex
+	password string
+	fetched  time.Time
+}
+
+// BeforeConnect is a BeforeConnect hook that sets the password of the
+// connection. When combined with Connector.BeforeConnect, it must run first.
+func (x *SecretPassword) BeforeConnect(ctx context.Context, conn *pgx.ConnConfig) error {
+	password, err := x.Password(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn.Password = password
+
+	// watch the authentication for a rejected password. pgconn calls
+	// AfterNetConnect once TLS is established, so the messages are plaintext.
+	next := conn.AfterNetConnect
+	conn.AfterNetConnect = func(ctx context.Context, config *pgconn.Config, c net.Conn) (net.Conn, error) {
+		if next != nil {
+			var err error
+			if c, err = next(ctx, config, c); err != nil {
+				return nil, err
+			}
+		}
+
+		return &authConn{Conn: c, rejected: func() { x.invalidate(password) }}, nil
+	}
+
+	return nil
+}
+
+// Password returns the cached password, fetching it when it is missing or
+// older than RefreshInterval. When a refresh fails, the cached password keeps
+// being used. Concurrent callers share a single fetch.
+func (x *SecretPassword) Password(ctx context.Context) (string, error) {
+	interval := x.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultSecretRefreshInterval
+	}
+
+	x.mu.Lock()
+	if !x.fetched.IsZero() && time.Since(x.fetched) < interval {
+		defer x.mu.Unlock()
+		return x.password, nil
+	}
+	x.mu.Unlock()
+
+	// the secret is accessed without holding the lock
+	value, err, _ := x.group.Do(x.Secret, func() (any, error) {
+		return x.fetch(ctx)
+	})
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	switch {
+	case err == nil:
+		x.password = value.(string)
+		x.fetched = time.Now()
+	case x.fetched.IsZero():
+		return "", err
+	}
+
+	return x.password, nil
+}
+
+// Invalidate drops the cached password, so the next connection fetches it
+// again.
+func (x *SecretPassword) Invalidate() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.password = ""
+	x.fetched = time.Time{}
+}
+
+// invalidate drops the cached password unless it has already been replaced.
+func (x *SecretPassword) invalidate(password string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.password == password {
+		x.password = ""
+		x.fetched = time.Time{}
+	}
+}
+
+// fetch accesses the secret version.
+func (x *SecretPassword) fetch(ctx context.Context) (string, error) {
+	name := x.Secret
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	response, err := x.Client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return "", fmt.Errorf("pgxgcp: access secret %s: %w", name, err)
+	}
+
+	return string(response.GetPayload().GetData()), nil
+}
+
+// authConn is a net.Conn that scans the messages of the server until the
+// authentication completes and calls rejected when it fails with SQLSTATE
+// 28P01.
+type authConn struct {
+	net.Conn
+	rejected func()
+
+	buf  []byte
+	done bool
+}
+
+// Read implements net.Conn.
+func (c *authConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.scan(p[:n])
+	}
+
+	return n, err
+}
+
+// scan consumes the bytes read from the server.
+func (c *authConn) scan(data []byte) {
+	if c.done {
+		return
+	}
+
+	c.buf = append(c.buf, data...)
+	for len(c.buf) >= 5 {
+		kind := c.buf[0]
+		size := int(binary.BigEndian.Uint32(c.buf[1:5]))
+		// not a startup message, stop scanning
+		if size < 4 || size > 1<<16 {
+			c.stop()
+			return
+		}
+
+		if len(c.buf) < 1+size {
+			return
+		}
+
+		body := c.buf[5 : 1+size]
+		c.buf = c.buf[1+size:]
+
+		switch kind {
+		case 'E':
+			msg := &pgproto3.ErrorResponse{}
+			if msg.Decode(body) == nil && msg.Code == invalidPasswordCode {
+				c.rejected()
+			}
+			c.stop()
+			return
+		case 'R':
+			// AuthenticationOk
+			if len(body) >= 4 && binary.BigEndian.Uint32(body) == 0 {
+				c.stop()
+				return
+			}
+		}
+	}
+}
+
+// stop ends the scanning.
+func (c *authConn) stop() {
+	c.done = true
+	c.buf = nil
+}
@@ -0,0 +1,235 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+var _ = Describe("SecretPassword", func() {
+	var (
+		ctx      context.Context
+		server   *pgxgcptest.SecretManager
+		password *pgxgcp.SecretPassword
+	)
+
+	const latest = "projects/p/secrets/db/versions/latest"
+
+	// authenticate connects with the hook and lets the server answer the
+	// startup with the given message.
+	authenticate := func(message pgproto3.BackendMessage) {
+		conn := &pgx.ConnConfig{}
+		Expect(password.BeforeConnect(ctx, conn)).To(Succeed())
+
+		server, client := net.Pipe()
+		DeferCleanup(server.Close)
+
+		c, err := conn.AfterNetConnect(ctx, &conn.Config, client)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(c.Close)
+
+		data, err := message.Encode(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		go server.Write(data)
+
+		buf := make([]byte, len(data))
+		_, err = c.Read(buf[:3])
+		Expect(err).NotTo(HaveOccurred())
+		_, err = c.Read(buf[3:])
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// reject starts a Postgres server on localhost that accepts TLS and rejects
+	// the password of every connection, and returns its address.
+	reject := func() string {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+		cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}}}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+
+					if _, err := pgproto3.NewBackend(conn, conn).ReceiveStartupMessage(); err != nil {
+						return
+					}
+					if _, err := conn.Write([]byte("S")); err != nil {
+						return
+					}
+
+					secure := tls.Server(conn, config)
+					backend := pgproto3.NewBackend(secure, secure)
+					if _, err := backend.ReceiveStartupMessage(); err != nil {
+						return
+					}
+
+					backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed"})
+					_ = backend.Flush()
+				}()
+			}
+		}()
+
+		return listener.Addr().String()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		server = &pgxgcptest.SecretManager{}
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Close)
+
+		client, err := secretmanager.NewClient(ctx, server.ClientOptions()...)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+
+		server.AddVersion("projects/p/secrets/db", "first")
+
+		password = &pgxgcp.SecretPassword{
+			Client: client,
+			Secret: "projects/p/secrets/db",
+		}
+	})
+
+	It("sets the password of the connection", func() {
+		conn := &pgx.ConnConfig{}
+		Expect(password.BeforeConnect(ctx, conn)).To(Succeed())
+		Expect(conn.Password).To(Equal("first"))
+	})
+
+	It("caches the password", func() {
+		for range 3 {
+			Expect(password.Password(ctx)).To(Equal("first"))
+		}
+		Expect(server.Accesses(latest)).To(Equal(1))
+	})
+
+	It("refreshes the password once it is old", func() {
+		password.RefreshInterval = 10 * time.Millisecond
+		Expect(password.Password(ctx)).To(Equal("first"))
+
+		server.AddVersion("projects/p/secrets/db", "second")
+		time.Sleep(20 * time.Millisecond)
+
+		Expect(password.Password(ctx)).To(Equal("second"))
+		Expect(server.Accesses(latest)).To(Equal(2))
+	})
+
+	It("keeps the cached password when a refresh fails", func() {
+		password.RefreshInterval = 10 * time.Millisecond
+		Expect(password.Password(ctx)).To(Equal("first"))
+
+		password.Secret = "projects/p/secrets/unknown"
+		time.Sleep(20 * time.Millisecond)
+
+		Expect(password.Password(ctx)).To(Equal("first"))
+	})
+
+	It("fails without a cached password", func() {
+		password.Secret = "projects/p/secrets/unknown"
+
+		_, err := password.Password(ctx)
+		Expect(err).To(MatchError(ContainSubstring("access secret projects/p/secrets/unknown/versions/latest")))
+	})
+
+	It("fetches the password again after it is rejected", func() {
+		authenticate(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed"})
+
+		server.AddVersion("projects/p/secrets/db", "second")
+
+		Expect(password.Password(ctx)).To(Equal("second"))
+		Expect(server.Accesses(latest)).To(Equal(2))
+	})
+
+	It("fetches the password again after it is rejected over TLS", func() {
+		host, port, err := net.SplitHostPort(reject())
+		Expect(err).NotTo(HaveOccurred())
+
+		config, err := pgx.ParseConfig("host=" + host + " port=" + port + " user=postgres sslmode=require")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(password.BeforeConnect(ctx, config)).To(Succeed())
+
+		_, err = pgx.ConnectConfig(ctx, config)
+		Expect(err).To(MatchError(ContainSubstring("28P01")))
+
+		server.AddVersion("projects/p/secrets/db", "second")
+
+		Expect(password.Password(ctx)).To(Equal("second"))
+		Expect(server.Accesses(latest)).To(Equal(2))
+	})
+
+	It("shares a fetch between concurrent callers", func() {
+		server.Latency = 50 * time.Millisecond
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Go(func() {
+				defer GinkgoRecover()
+				Expect(password.Password(ctx)).To(Equal("first"))
+			})
+		}
+		wg.Wait()
+
+		Expect(server.Accesses(latest)).To(Equal(1))
+	})
+
+	It("does not hold the lock while fetching", func() {
+		server.Latency = time.Second
+
+		go password.Password(ctx)
+		time.Sleep(50 * time.Millisecond)
+
+		// the cached password can be dropped while the fetch is in flight
+		done := make(chan struct{})
+		go func() {
+			password.Invalidate()
+			close(done)
+		}()
+		Eventually(done).WithTimeout(500 * time.Millisecond).Should(BeClosed())
+	})
+
+	It("keeps the password after other errors", func() {
+		authenticate(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "3D000", Message: "database does not exist"})
+
+		Expect(password.Password(ctx)).To(Equal("first"))
+		Expect(server.Accesses(latest)).To(Equal(1))
+	})
+
+	It("keeps the password after a successful login", func() {
+		authenticate(&pgproto3.AuthenticationOk{})
+
+		Expect(password.Password(ctx)).To(Equal("first"))
+		Expect(server.Accesses(latest)).To(Equal(1))
+	})
+})
@@ -0,0 +1,24 @@
+package pgxgcp
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+)
+
+// DefaultSocketDir is the directory in which the Cloud SQL Auth Proxy creates
+// the Unix sockets of the instances on Cloud Run and in the proxy sidecar.
+const DefaultSocketDir = "/cloudsql"
+
+// SocketPath returns the path of the Unix socket the Cloud SQL Auth Proxy
+// exposes for the instance in dir, e.g.
+// /cloudsql/project:region:instance/.s.PGSQL.5432.
+func SocketPath(dir, instance string) string {
+	return filepath.Join(dir, instance, ".s.PGSQL.5432")
+}
+
+// dialSocket dials the Auth Proxy socket of the instance.
+func dialSocket(ctx context.Context, dir, instance string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "unix", SocketPath(dir, instance))
+}
@@ -0,0 +1,77 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+)
+
+var _ = Describe("SocketDir", func() {
+	var (
+		ctx context.Context
+		dir string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		var err error
+		// unix socket paths are limited to roughly 100 bytes
+		dir, err = os.MkdirTemp("", "pgxgcp")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+	})
+
+	It("returns the Auth Proxy socket path", func() {
+		Expect(pgxgcp.SocketPath(pgxgcp.DefaultSocketDir, "project:region:instance")).
+			To(Equal("/cloudsql/project:region:instance/.s.PGSQL.5432"))
+	})
+
+	It("dials the Auth Proxy socket of the instance", func() {
+		path := pgxgcp.SocketPath(dir, "project:region:instance")
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+
+		listener, err := net.Listen("unix", path)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+
+		connector := &pgxgcp.Connector{SocketDir: dir}
+
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(c.Close)
+
+		Expect(c.RemoteAddr().String()).To(Equal(path))
+	})
+
+	It("fails when the proxy is not running", func() {
+		connector := &pgxgcp.Connector{SocketDir: dir}
+
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		_, err := conn.DialFunc(ctx, "tcp", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("is configured by the socket_dir parameter of ParseConfig", func() {
+		config, connector, err := pgxgcp.ParseConfig(ctx, "cloudsql://project:region:instance/app?socket_dir=/cloudsql")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(connector.Close)
+
+		Expect(connector.SocketDir).To(Equal("/cloudsql"))
+		Expect(connector.Dialer).To(BeNil())
+		Expect(config.ConnConfig.RuntimeParams).NotTo(HaveKey("socket_dir"))
+	})
+})
@@ -1,8 +1,13 @@
 package pgxgcp_test
 
 import (
+	"fmt"
+	"net"
+	"sync"
 	"testing"
 
+	"github.com/jackc/pgx/v5/pgproto3"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -11,3 +16,135 @@ func TestPgxgcp(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "pgxgcp Suite")
 }
+
+// listen starts a TCP listener on localhost that accepts and holds
+// connections until the spec ends, and returns its address.
+func listen() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	DeferCleanup(func() {
+		listener.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	return listener.Addr().String()
+}
+
+// postgres starts a TCP listener on localhost that completes the startup of
+// every connection like a Postgres server trusting the client, and returns its
+// address. SSL is declined and simple queries are answered with a single text
+// column holding the given rows.
+func postgres(rows ...string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			go serve(conn, rows)
+		}
+	}()
+
+	DeferCleanup(func() {
+		listener.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	return listener.Addr().String()
+}
+
+// serve speaks the server side of the Postgres protocol for postgres.
+func serve(conn net.Conn, rows []string) {
+	backend := pgproto3.NewBackend(conn, conn)
+
+	for {
+		message, err := backend.ReceiveStartupMessage()
+		if err != nil {
+			return
+		}
+
+		if _, ok := message.(*pgproto3.SSLRequest); ok {
+			// decline SSL, the client continues in plaintext
+			if _, err := conn.Write([]byte("N")); err != nil {
+				return
+			}
+			continue
+		}
+
+		break
+	}
+
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: []byte{0, 0, 0, 1}})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		message, err := backend.Receive()
+		if err != nil {
+			return
+		}
+
+		if _, ok := message.(*pgproto3.Query); !ok {
+			continue
+		}
+
+		backend.Send(&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+			{Name: []byte("value"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1},
+		}})
+		for _, row := range rows {
+			backend.Send(&pgproto3.DataRow{Values: [][]byte{[]byte(row)}})
+		}
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(fmt.Sprintf("SELECT %d", len(rows)))})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if err := backend.Flush(); err != nil {
+			return
+		}
+	}
+}
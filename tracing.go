@@ -0,0 +1,53 @@
+package pgxgcp
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IPTypeKey is the attribute key of the IP type dialed, see IPType.
+const IPTypeKey = attribute.Key("cloudsql.ip_type")
+
+// startDial starts the span of a dial to the given instance as a child of the
+// span in ctx.
+func (x *Connector) startDial(ctx context.Context, instance string) (context.Context, trace.Span) {
+	provider := x.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	attributes := []attribute.KeyValue{InstanceKey.String(instance)}
+	// the ip type is only known when it is configured on the connector
+	if kind := x.ipType(instance); kind != "" {
+		attributes = append(attributes, IPTypeKey.String(string(kind)))
+	}
+
+	return provider.Tracer(ScopeName).Start(ctx, "pgxgcp.dial",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// ipType returns the IP type configured for the instance, if any.
+func (x *Connector) ipType(instance string) IPType {
+	if config, ok := x.Instances[instance]; ok && config.IPType != "" {
+		return config.IPType
+	}
+
+	return x.IPType
+}
+
+// endDial ends the span of a dial with the outcome of the dial.
+func endDial(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(ErrorClassKey.String(ErrorClass(err)))
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,100 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		ctx       context.Context
+		recorder  *tracetest.SpanRecorder
+		dialer    *pgxgcptest.Dialer
+		connector *pgxgcp.Connector
+	)
+
+	dial := func(ctx context.Context) error {
+		conn := &pgx.ConnConfig{}
+		conn.Host = "project:region:instance"
+		Expect(connector.BeforeConnect(ctx, conn)).To(Succeed())
+
+		c, err := conn.DialFunc(ctx, "tcp", "")
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		recorder = tracetest.NewSpanRecorder()
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{"project:region:instance": listen()},
+		}
+		connector = &pgxgcp.Connector{
+			Dialer:         dialer,
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+			Instances: map[string]pgxgcp.InstanceConfig{
+				"project:region:instance": {IPType: pgxgcp.IPTypePrivate},
+			},
+		}
+	})
+
+	It("records a span for the dial", func() {
+		Expect(dial(ctx)).To(Succeed())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name()).To(Equal("pgxgcp.dial"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Unset))
+		Expect(spans[0].Attributes()).To(ContainElements(
+			pgxgcp.InstanceKey.String("project:region:instance"),
+			pgxgcp.IPTypeKey.String("private"),
+		))
+	})
+
+	It("records the ip type of the connector", func() {
+		connector.Instances = nil
+		connector.IPType = pgxgcp.IPTypePSC
+
+		Expect(dial(ctx)).To(Succeed())
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Attributes()).To(ContainElement(pgxgcp.IPTypeKey.String("psc")))
+	})
+
+	It("parents the span on the dial context", func() {
+		parent, span := connector.TracerProvider.Tracer("test").Start(ctx, "request")
+		Expect(dial(parent)).To(Succeed())
+		span.End()
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Parent().SpanID()).To(Equal(span.SpanContext().SpanID()))
+		Expect(spans[0].SpanContext().TraceID()).To(Equal(span.SpanContext().TraceID()))
+	})
+
+	It("records the error status", func() {
+		dialer.Fail("project:region:instance", errors.New("boom"))
+
+		Expect(dial(ctx)).To(MatchError("boom"))
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		Expect(spans[0].Status().Description).To(Equal("boom"))
+		Expect(spans[0].Attributes()).To(ContainElement(attribute.String("error.class", "other")))
+		Expect(spans[0].Events()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,124 @@
+package pgxgcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5"
+)
+
+// warmer is implemented by dialers that can fetch the metadata and certificate
+// of an instance ahead of the first dial, such as *cloudsqlconn.Dialer.
+type warmer interface {
+	Warmup(ctx context.Context, instance string, options ...cloudsqlconn.DialOption) error
+}
+
+var _ warmer = &cloudsqlconn.Dialer{}
+
+// WarmupResult is the outcome of warming up a single instance.
+type WarmupResult struct {
+	// Instance is the instance connection name.
+	Instance string
+	// Duration is the time taken to warm up the instance.
+	Duration time.Duration
+	// Err is the error that occurred, if any.
+	Err error
+}
+
+// WarmupReport holds the results of Warmup in the order of the instances.
+type WarmupReport []WarmupResult
+
+// Err returns the errors of the failed instances joined, or nil when all of
+// them were warmed up.
+func (r WarmupReport) Err() error {
+	var errs []error
+	for _, result := range r {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("pgxgcp: warmup %s: %w", result.Instance, result.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Warmup concurrently primes the dialer for the given instances, so the first
+// connection does not pay for fetching the instance metadata and the
+// ephemeral certificate, e.g. during a startup probe. A dialer that cannot be
+// warmed up by itself dials and closes one connection per instance. Overridden
+// instances and the Auth Proxy sidecar mode need no warmup.
+func (x *Connector) Warmup(ctx context.Context, instances ...string) WarmupReport {
+	return x.warmup(ctx, instances, func(ctx context.Context, instance string) error {
+		// a logical database host warms up its active instance
+		instance = x.Active(instance)
+
+		ok, err := x.match(instance)
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			return fmt.Errorf("pgxgcp: %q is not a Cloud SQL instance", instance)
+		}
+
+		if !x.dialer(instance) {
+			return nil
+		}
+
+		if dialer, ok := x.Dialer.(warmer); ok {
+			options, err := x.options(instance)
+			if err != nil {
+				return err
+			}
+			return dialer.Warmup(ctx, instance, options...)
+		}
+
+		conn, err := x.dial(ctx, instance)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// WarmupConnect concurrently opens, pings and closes one connection to each of
+// the given instances with a copy of config, which must have been created by
+// pgx.ParseConfig or pgxpool.ParseConfig. Unlike Warmup it also verifies the
+// credentials and the reachability of the database.
+func (x *Connector) WarmupConnect(ctx context.Context, config *pgx.ConnConfig, instances ...string) WarmupReport {
+	return x.warmup(ctx, instances, func(ctx context.Context, instance string) error {
+		config := config.Copy()
+		config.Host = instance
+
+		if err := x.BeforeConnect(ctx, config); err != nil {
+			return err
+		}
+
+		conn, err := pgx.ConnectConfig(ctx, config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close(context.WithoutCancel(ctx))
+
+		return conn.Ping(ctx)
+	})
+}
+
+// warmup runs warm for each instance concurrently and reports the outcomes.
+func (x *Connector) warmup(ctx context.Context, instances []string, warm func(context.Context, string) error) WarmupReport {
+	report := make(WarmupReport, len(instances))
+
+	var wg sync.WaitGroup
+	for index, instance := range instances {
+		wg.Go(func() {
+			start := time.Now()
+			err := warm(ctx, instance)
+			report[index] = WarmupResult{Instance: instance, Duration: time.Since(start), Err: err}
+		})
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,110 @@
+package pgxgcp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pgx-contrib/pgxgcp"
+	"github.com/pgx-contrib/pgxgcp/pgxgcptest"
+)
+
+// dialOnly hides the Warmup method of the fake dialer.
+type dialOnly struct {
+	pgxgcp.Dialer
+}
+
+var _ = Describe("Warmup", func() {
+	var (
+		ctx       context.Context
+		dialer    *pgxgcptest.Dialer
+		connector *pgxgcp.Connector
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dialer = &pgxgcptest.Dialer{
+			Instances: map[string]string{
+				"project:region:orders":  listen(),
+				"project:region:billing": listen(),
+			},
+		}
+		connector = &pgxgcp.Connector{Dialer: dialer}
+	})
+
+	It("warms up the instances through the dialer", func() {
+		report := connector.Warmup(ctx, "project:region:orders", "project:region:billing")
+
+		Expect(report.Err()).NotTo(HaveOccurred())
+		Expect(report).To(HaveLen(2))
+		Expect(report[0].Instance).To(Equal("project:region:orders"))
+		Expect(report[1].Instance).To(Equal("project:region:billing"))
+		Expect(dialer.Warmups("project:region:orders")).To(Equal(1))
+		Expect(dialer.Warmups("project:region:billing")).To(Equal(1))
+		Expect(dialer.Dials("project:region:orders")).To(BeZero())
+	})
+
+	It("reports the failed instances", func() {
+		failure := errors.New("forbidden")
+		dialer.Fail("project:region:billing", failure)
+
+		report := connector.Warmup(ctx, "project:region:orders", "project:region:billing", "localhost")
+
+		Expect(report[0].Err).NotTo(HaveOccurred())
+		Expect(report[1].Err).To(MatchError(failure))
+		Expect(report[2].Err).To(MatchError(ContainSubstring("not a Cloud SQL instance")))
+		Expect(report.Err()).To(MatchError(failure))
+		Expect(report.Err()).To(MatchError(ContainSubstring("warmup project:region:billing")))
+	})
+
+	It("dials once when the dialer cannot warm up", func() {
+		connector.Dialer = dialOnly{dialer}
+
+		report := connector.Warmup(ctx, "project:region:orders")
+
+		Expect(report.Err()).NotTo(HaveOccurred())
+		Expect(dialer.Dials("project:region:orders")).To(Equal(1))
+	})
+
+	It("warms up the active instance of a failover host", func() {
+		connector.Failover = map[string][]string{
+			"orders": {"project:region:orders", "project:region:billing"},
+		}
+
+		Expect(connector.Warmup(ctx, "orders").Err()).NotTo(HaveOccurred())
+		Expect(dialer.Warmups("project:region:orders")).To(Equal(1))
+	})
+
+	It("skips overridden instances", func() {
+		connector.Overrides = map[string]string{"project:region:orders": "localhost:5432"}
+
+		Expect(connector.Warmup(ctx, "project:region:orders").Err()).NotTo(HaveOccurred())
+		Expect(dialer.Warmups("project:region:orders")).To(BeZero())
+	})
+
+	Describe("WarmupConnect", func() {
+		It("opens and pings a connection", func() {
+			url := os.Getenv("PGX_DATABASE_URL")
+			if url == "" {
+				Skip("PGX_DATABASE_URL not set")
+			}
+
+			config, err := pgx.ParseConfig(url)
+			Expect(err).NotTo(HaveOccurred())
+
+			// map the instance to the local Postgres server
+			dialer.Instances["project:region:orders"] = net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port)))
+			config.TLSConfig = nil
+			config.Fallbacks = nil
+
+			report := connector.WarmupConnect(ctx, config, "project:region:orders")
+			Expect(report.Err()).NotTo(HaveOccurred())
+			Expect(dialer.Dials("project:region:orders")).To(Equal(1))
+		})
+	})
+})